@@ -0,0 +1,351 @@
+// Package fakeupstream 在本地模拟微软翻译端点、语音列表和语音合成接口 (REST 与 WebSocket)，
+// 相同的 SSML 和输出格式总是返回相同的音频，用于集成测试或离线调试：
+//
+//	upstream := fakeupstream.New()
+//	defer upstream.Close()
+//	utils.SetUpstreamURLs(upstream.URLs())
+package fakeupstream
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ms-tts-go/utils"
+
+	"golang.org/x/net/websocket"
+)
+
+// 模拟服务的接口路径
+const (
+	PathEndpoint   = "/apps/endpoint"
+	PathVoices     = "/cognitiveservices/voices/list"
+	PathIssueToken = "/sts/v1.0/issueToken"
+	PathSynthesize = "/cognitiveservices/v1"
+	PathWebSocket  = "/cognitiveservices/websocket/v1"
+)
+
+// Region 模拟服务返回的区域
+const Region = "fakeregion"
+
+// wordDuration 每个单词的模拟时长
+const wordDuration = 300 * time.Millisecond
+
+var (
+	tagPattern        = regexp.MustCompile(`<[^>]*>`)
+	sampleRatePattern = regexp.MustCompile(`(\d+)(k?)hz`)
+)
+
+// Server 模拟的上游服务
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests map[string]int
+	failures map[string]int
+}
+
+// New 启动模拟服务，使用完毕后调用 Close
+func New() *Server {
+	s := &Server{
+		requests: make(map[string]int),
+		failures: make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathEndpoint, s.handleEndpoint)
+	mux.HandleFunc(PathVoices, s.handleVoices)
+	mux.HandleFunc(PathIssueToken, s.handleIssueToken)
+	mux.HandleFunc(PathSynthesize, s.handleSynthesize)
+	mux.HandleFunc(PathWebSocket, func(w http.ResponseWriter, r *http.Request) {
+		// 模拟失败时在握手阶段拒绝，与真实服务一样返回普通的 HTTP 错误响应
+		if s.fail(w, PathWebSocket) {
+			return
+		}
+		websocket.Server{Handler: s.handleWebSocket}.ServeHTTP(w, r)
+	})
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// URLs 返回指向模拟服务的上游地址，可直接传给 utils.SetUpstreamURLs
+func (s *Server) URLs() utils.UpstreamURLs {
+	return utils.UpstreamURLs{
+		Endpoint:   s.URL + PathEndpoint + "?api-version=1.0",
+		Voices:     s.URL + PathVoices,
+		Speech:     s.URL,
+		AzureToken: s.URL + PathIssueToken,
+	}
+}
+
+// Requests 返回 path 收到的请求数
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// Fail 让之后发往 path 的请求返回 status，status 为 0 时恢复正常；429 和 503 带有 Retry-After: 1
+func (s *Server) Fail(path string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if status == 0 {
+		delete(s.failures, path)
+		return
+	}
+	s.failures[path] = status
+}
+
+// begin 记录请求并返回需要模拟的失败状态码
+func (s *Server) begin(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[path]++
+	return s.failures[path]
+}
+
+// fail 记录请求，需要模拟失败时写入错误响应并返回 true
+func (s *Server) fail(w http.ResponseWriter, path string) bool {
+	status := s.begin(path)
+	if status == 0 {
+		return false
+	}
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
+	http.Error(w, http.StatusText(status), status)
+	return true
+}
+
+func (s *Server) handleEndpoint(w http.ResponseWriter, r *http.Request) {
+	if s.fail(w, PathEndpoint) {
+		return
+	}
+	if r.Method != http.MethodPost || r.Header.Get("X-MT-Signature") == "" {
+		http.Error(w, "missing signature", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"r": Region, "t": Token()})
+}
+
+func (s *Server) handleIssueToken(w http.ResponseWriter, r *http.Request) {
+	if s.fail(w, PathIssueToken) {
+		return
+	}
+	if r.Method != http.MethodPost || r.Header.Get("Ocp-Apim-Subscription-Key") == "" {
+		http.Error(w, "missing subscription key", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(Token()))
+}
+
+func (s *Server) handleVoices(w http.ResponseWriter, r *http.Request) {
+	if s.fail(w, PathVoices) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Voices())
+}
+
+func (s *Server) handleSynthesize(w http.ResponseWriter, r *http.Request) {
+	if s.fail(w, PathSynthesize) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("Authorization") == "" {
+		http.Error(w, "missing authorization", http.StatusUnauthorized)
+		return
+	}
+
+	outputFormat := r.Header.Get("X-Microsoft-OutputFormat")
+	if !utils.IsSupportedOutputFormat(outputFormat) {
+		http.Error(w, "unsupported output format", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	ssml, err := io.ReadAll(r.Body)
+	if err != nil || !strings.Contains(string(ssml), "<speak") {
+		http.Error(w, "invalid ssml", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", utils.ContentTypeOf(outputFormat))
+	w.Write(Audio(string(ssml), outputFormat))
+}
+
+// handleWebSocket 按 speech.config、ssml 的顺序接收消息，依次返回 turn.start、单词边界、音频和 turn.end
+func (s *Server) handleWebSocket(conn *websocket.Conn) {
+	defer conn.Close()
+
+	var outputFormat, ssml, requestID string
+	for ssml == "" {
+		var data string
+		if err := websocket.Message.Receive(conn, &data); err != nil {
+			return
+		}
+		headers, body := parseFrame(data)
+		requestID = headers["x-requestid"]
+		switch headers["path"] {
+		case "speech.config":
+			var config struct {
+				Context struct {
+					Synthesis struct {
+						Audio struct {
+							OutputFormat string `json:"outputFormat"`
+						} `json:"audio"`
+					} `json:"synthesis"`
+				} `json:"context"`
+			}
+			json.Unmarshal([]byte(body), &config)
+			outputFormat = config.Context.Synthesis.Audio.OutputFormat
+		case "ssml":
+			ssml = body
+		}
+	}
+
+	send := func(path, contentType, body string) error {
+		return websocket.Message.Send(conn, fmt.Sprintf("X-RequestId:%s\r\nContent-Type:%s\r\nPath:%s\r\n\r\n%s", requestID, contentType, path, body))
+	}
+
+	if err := send("turn.start", "application/json; charset=utf-8", "{}"); err != nil {
+		return
+	}
+	for _, metadata := range wordMetadata(ssml) {
+		if err := send("audio.metadata", "application/json", metadata); err != nil {
+			return
+		}
+	}
+
+	header := fmt.Sprintf("X-RequestId:%s\r\nContent-Type:audio/x-wav\r\nPath:audio\r\n", requestID)
+	frame := make([]byte, 2, 2+len(header))
+	binary.BigEndian.PutUint16(frame, uint16(len(header)))
+	frame = append(frame, header...)
+	if err := websocket.Message.Send(conn, append(frame, Audio(ssml, outputFormat)...)); err != nil {
+		return
+	}
+
+	send("turn.end", "application/json; charset=utf-8", "{}")
+}
+
+// parseFrame 拆分文本消息的头部和正文
+func parseFrame(data string) (map[string]string, string) {
+	head, body, _ := strings.Cut(data, "\r\n\r\n")
+	headers := make(map[string]string)
+	for _, line := range strings.Split(head, "\r\n") {
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			headers[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+	return headers, body
+}
+
+// wordMetadata 为 SSML 中的每个单词生成一条 audio.metadata 消息
+func wordMetadata(ssml string) []string {
+	var messages []string
+	for i, word := range Words(ssml) {
+		item := map[string]interface{}{
+			"Type": "WordBoundary",
+			"Data": map[string]interface{}{
+				"Offset":   int64(i) * int64(wordDuration/100),
+				"Duration": int64(wordDuration / 100),
+				"text": map[string]interface{}{
+					"Text":         word,
+					"Length":       len([]rune(word)),
+					"BoundaryType": "WordBoundary",
+				},
+			},
+		}
+		data, _ := json.Marshal(map[string]interface{}{"Metadata": []interface{}{item}})
+		messages = append(messages, string(data))
+	}
+	return messages
+}
+
+// Words 返回 SSML 正文中以空白分隔的单词
+func Words(ssml string) []string {
+	return strings.Fields(html.UnescapeString(tagPattern.ReplaceAllString(ssml, " ")))
+}
+
+// Token 生成一小时后过期的 JWT，签名部分没有意义
+func Token() string {
+	encode := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	header := encode(map[string]string{"alg": "none", "typ": "JWT"})
+	payload := encode(map[string]interface{}{"region": Region, "exp": time.Now().Add(time.Hour).Unix()})
+	return header + "." + payload + ".fake"
+}
+
+// Audio 返回 SSML 对应的模拟音频，每个单词 300 毫秒。
+// riff 格式为带 WAV 头的 16 位 PCM，raw 格式为裸 PCM，其他格式只是由 SSML 决定的字节序列
+func Audio(ssml, outputFormat string) []byte {
+	words := len(Words(ssml))
+	if words == 0 {
+		words = 1
+	}
+
+	sampleRate := 16000
+	if m := sampleRatePattern.FindStringSubmatch(outputFormat); m != nil {
+		sampleRate, _ = strconv.Atoi(m[1])
+		if m[2] == "k" {
+			sampleRate *= 1000
+		}
+	}
+	size := sampleRate * 2 * words * int(wordDuration/time.Millisecond) / 1000
+	data := deterministicBytes(outputFormat+"\x00"+ssml, size)
+
+	if strings.HasPrefix(outputFormat, "riff-") {
+		return append(wavHeader(sampleRate, len(data)), data...)
+	}
+	return data
+}
+
+// deterministicBytes 由 seed 反复哈希得到 size 字节
+func deterministicBytes(seed string, size int) []byte {
+	data := make([]byte, 0, size+sha256.Size)
+	sum := sha256.Sum256([]byte(seed))
+	for len(data) < size {
+		data = append(data, sum[:]...)
+		sum = sha256.Sum256(sum[:])
+	}
+	return data[:size]
+}
+
+// wavHeader 16 位单声道 PCM 的 WAV 头
+func wavHeader(sampleRate, dataSize int) []byte {
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36+dataSize))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1)
+	binary.LittleEndian.PutUint16(header[22:], 1)
+	binary.LittleEndian.PutUint32(header[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(sampleRate*2))
+	binary.LittleEndian.PutUint16(header[32:], 2)
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(dataSize))
+	return header
+}
@@ -0,0 +1,72 @@
+package fakeupstream
+
+import (
+	"strings"
+
+	"ms-tts-go/utils"
+)
+
+// fakeVoices 模拟语音列表：短名称、性别、风格、角色
+var fakeVoices = []struct {
+	shortName string
+	gender    string
+	styles    []string
+	roles     []string
+}{
+	{"zh-CN-XiaoxiaoMultilingualNeural", "Female", []string{"affectionate", "cheerful", "sad", "angry", "whispering"}, nil},
+	{"zh-CN-XiaoxiaoNeural", "Female", []string{"assistant", "cheerful", "sad", "angry", "calm"}, nil},
+	{"zh-CN-XiaomoNeural", "Female", []string{"cheerful", "sad", "calm"}, []string{"Girl", "Boy", "OlderAdultFemale"}},
+	{"zh-CN-XiaoyiNeural", "Female", []string{"cheerful", "sad"}, nil},
+	{"zh-CN-XiaoruiNeural", "Female", []string{"calm", "sad"}, nil},
+	{"zh-CN-XiaohanNeural", "Female", []string{"cheerful", "gentle"}, nil},
+	{"zh-CN-YunxiNeural", "Male", []string{"cheerful", "sad", "narration-relaxed"}, []string{"Boy", "Narrator"}},
+	{"zh-CN-YunjieNeural", "Male", nil, nil},
+	{"zh-CN-YunfengNeural", "Male", []string{"angry", "cheerful"}, nil},
+	{"zh-CN-YunjianNeural", "Male", []string{"narration-relaxed", "sports-commentary"}, nil},
+	{"zh-CN-YunyangNeural", "Male", []string{"customerservice", "narration-professional"}, nil},
+	{"zh-CN-YunzeNeural", "Male", []string{"calm", "sad"}, []string{"OlderAdultMale"}},
+	{"en-US-AvaMultilingualNeural", "Female", nil, nil},
+	{"en-US-EmmaMultilingualNeural", "Female", nil, nil},
+	{"en-US-AndrewMultilingualNeural", "Male", nil, nil},
+	{"en-US-BrianMultilingualNeural", "Male", nil, nil},
+	{"en-US-AriaNeural", "Female", []string{"cheerful", "sad", "whispering"}, nil},
+	{"en-US-JennyNeural", "Female", []string{"assistant", "cheerful", "sad"}, nil},
+	{"en-US-SaraNeural", "Female", []string{"cheerful", "sad"}, nil},
+	{"en-US-DavisNeural", "Male", []string{"cheerful", "whispering"}, nil},
+	{"en-US-ChristopherNeural", "Male", nil, nil},
+	{"en-GB-RyanNeural", "Male", []string{"cheerful", "chat"}, nil},
+	{"ja-JP-NanamiNeural", "Female", []string{"chat", "cheerful"}, nil},
+	{"ja-JP-KeitaNeural", "Male", nil, nil},
+	{"ko-KR-SunHiNeural", "Female", nil, nil},
+	{"ko-KR-InJoonNeural", "Male", []string{"sad"}, nil},
+}
+
+// Voices 返回模拟服务的语音列表，包含内置 OpenAI 语音名称映射用到的全部语音
+func Voices() []utils.Voice {
+	voices := make([]utils.Voice, 0, len(fakeVoices))
+	for _, v := range fakeVoices {
+		parts := strings.SplitN(v.shortName, "-", 3)
+		locale := parts[0] + "-" + parts[1]
+		name := strings.TrimSuffix(parts[2], "Neural")
+
+		voice := utils.Voice{
+			Name:            "Microsoft Server Speech Text to Speech Voice (" + locale + ", " + parts[2] + ")",
+			DisplayName:     name,
+			LocalName:       name,
+			ShortName:       v.shortName,
+			Gender:          v.gender,
+			Locale:          locale,
+			LocaleName:      locale,
+			StyleList:       v.styles,
+			RolePlayList:    v.roles,
+			SampleRateHertz: "24000",
+			VoiceType:       "Neural",
+			Status:          "GA",
+		}
+		if strings.Contains(v.shortName, "Multilingual") {
+			voice.SecondaryLocaleList = []string{"zh-CN", "en-US", "ja-JP", "ko-KR"}
+		}
+		voices = append(voices, voice)
+	}
+	return voices
+}
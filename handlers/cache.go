@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"ms-tts-go/utils"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// audioCacheControl GET /tts 响应的 Cache-Control，max-age 在 Init 中按 HTTP_CACHE_MAX_AGE 设置
+var audioCacheControl = "private, max-age=86400"
+
+func httpCacheMaxAge() int {
+	value := os.Getenv("HTTP_CACHE_MAX_AGE")
+	if value == "" {
+		return 86400
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Warnf("Invalid HTTP_CACHE_MAX_AGE %q, using default 86400", value)
+		return 86400
+	}
+	return n
+}
+
+// setCacheHeader 通过 X-Cache 标明结果是否来自音频缓存
+func setCacheHeader(c *gin.Context, cache utils.CacheStatus) {
+	if cache.Hit {
+		c.Header("X-Cache", "HIT")
+	} else {
+		c.Header("X-Cache", "MISS")
+	}
+}
+
+// audioETag 合成参数的哈希即为 ETag，不需要合成就能判断客户端的副本是否仍然有效。
+// 缓存淘汰或提供方回退后重新合成的音频字节可能不同，所以只能是弱 ETag，
+// 带 If-Range 的续传请求不会把两次合成的数据拼在一起
+func audioETag(key string) string {
+	return `W/"` + key + `"`
+}
+
+// etagMatches 判断 If-None-Match 是否包含 etag，按弱比较处理
+func etagMatches(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// setValidatorHeaders 设置 ETag、Cache-Control 和 Accept-Ranges
+func setValidatorHeaders(c *gin.Context, key string) {
+	c.Header("ETag", audioETag(key))
+	c.Header("Cache-Control", audioCacheControl)
+	c.Header("Accept-Ranges", "bytes")
+}
+
+// notModified 客户端的 If-None-Match 与参数对应的 ETag 一致时直接返回 304
+func notModified(c *gin.Context, opts utils.SpeechOptions) bool {
+	ifNoneMatch := c.GetHeader("If-None-Match")
+	if ifNoneMatch == "" {
+		return false
+	}
+	key := utils.AudioCacheKey(opts)
+	if !etagMatches(ifNoneMatch, audioETag(key)) {
+		return false
+	}
+	setValidatorHeaders(c, key)
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+// serveAudio 返回带缓存校验信息的音频，缓存命中或请求了 Range 时读取完整数据，
+// 由 http.ServeContent 处理 Range (206/416) 和 If-Modified-Since，否则边合成边输出。
+// Last-Modified 为这份音频的生成时间，重新合成后随之改变，按日期的 If-Range 同样不会误判。
+// 读取音频失败时退回 charge 计入的字符
+func serveAudio(c *gin.Context, contentType string, body io.ReadCloser, cache utils.CacheStatus, charge *speechCharge) {
+	setCacheHeader(c, cache)
+	setValidatorHeaders(c, cache.Key)
+
+	if !cache.Hit && c.GetHeader("Range") == "" {
+		c.Header("Last-Modified", cache.StoredAt.UTC().Format(http.TimeFormat))
+		streamAudio(c, contentType, body)
+		return
+	}
+
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		log.Errorf("Failed to read synthesized audio: %v", err)
+		charge.refund()
+		c.Writer.Header().Del("ETag")
+		c.Writer.Header().Del("Cache-Control")
+		writeError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	http.ServeContent(c.Writer, c.Request, "", cache.StoredAt.Truncate(time.Second), bytes.NewReader(data))
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"ms-tts-go/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StatusClientClosedRequest 客户端在响应前断开连接 (nginx 约定的 499)
+const StatusClientClosedRequest = 499
+
+// apiError 描述一个上游错误对应的响应
+type apiError struct {
+	status  int
+	errType string
+	code    string
+	param   string
+}
+
+// classifyError 将 utils 返回的错误映射为 HTTP 状态码和 OpenAI 风格的错误类型
+func classifyError(err error) apiError {
+	switch {
+	case utils.IsCanceled(err):
+		return apiError{StatusClientClosedRequest, "server_error", "client_closed_request", ""}
+	case utils.IsTimeout(err):
+		return apiError{http.StatusGatewayTimeout, "server_error", "upstream_timeout", ""}
+	case errors.Is(err, utils.ErrRateLimited):
+		return apiError{http.StatusTooManyRequests, "rate_limit_error", "rate_limit_exceeded", ""}
+	case errors.Is(err, utils.ErrQuotaExceeded):
+		return apiError{http.StatusTooManyRequests, "insufficient_quota", "insufficient_quota", ""}
+	case errors.Is(err, utils.ErrVoiceNotAllowed):
+		return apiError{http.StatusForbidden, "permission_error", "voice_not_allowed", "voice"}
+	case errors.Is(err, utils.ErrAPIKeyNotFound):
+		return apiError{http.StatusNotFound, "invalid_request_error", "not_found", "id"}
+	case errors.Is(err, utils.ErrUpstreamThrottled):
+		return apiError{http.StatusTooManyRequests, "rate_limit_error", "rate_limit_exceeded", ""}
+	case errors.Is(err, utils.ErrUnsupportedFormat):
+		return apiError{http.StatusBadRequest, "invalid_request_error", "unsupported_response_format", "response_format"}
+	case errors.Is(err, utils.ErrInvalidInput):
+		return apiError{http.StatusBadRequest, "invalid_request_error", "invalid_input", utils.InvalidParam(err)}
+	case errors.Is(err, utils.ErrInvalidSSML):
+		return apiError{http.StatusBadRequest, "invalid_request_error", "invalid_ssml", "input"}
+	case errors.Is(err, utils.ErrUpstreamAuth):
+		return apiError{http.StatusBadGateway, "server_error", "upstream_auth_failed", ""}
+	case errors.Is(err, utils.ErrUpstreamUnavailable):
+		return apiError{http.StatusBadGateway, "server_error", "upstream_unavailable", ""}
+	default:
+		return apiError{http.StatusInternalServerError, "server_error", "", ""}
+	}
+}
+
+// setRetryAfter 上游限流时透传 Retry-After
+func setRetryAfter(c *gin.Context, err error) {
+	if retryAfter := utils.RetryAfter(err); retryAfter != "" {
+		c.Header("Retry-After", retryAfter)
+	}
+}
+
+// writeError 以 {"error": "..."} 格式返回错误
+func writeError(c *gin.Context, err error) {
+	e := classifyError(err)
+	setRetryAfter(c, err)
+	c.JSON(e.status, gin.H{"error": err.Error()})
+}
+
+// writeOpenAIError 以 OpenAI 风格返回错误
+func writeOpenAIError(c *gin.Context, err error, message string) {
+	e := classifyError(err)
+	setRetryAfter(c, err)
+	// 客户端请求错误、权限、配额不足或被限流时返回具体原因，便于调用方修正
+	if e.status == http.StatusBadRequest || e.status == http.StatusForbidden || e.errType == "insufficient_quota" ||
+		errors.Is(err, utils.ErrRateLimited) {
+		message = err.Error()
+	}
+	c.JSON(e.status, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    e.errType,
+			"param":   e.param,
+			"code":    e.code,
+		},
+	})
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"ms-tts-go/utils"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// writeMultiTTSSpeakers 以 MultiTTS 的 speaker YAML 格式输出语音列表
+func writeMultiTTSSpeakers(c *gin.Context, voices []utils.Voice) {
+	var b strings.Builder
+	for _, voice := range voices {
+		gender := "1"
+		if voice.Gender == "Female" {
+			gender = "0"
+		}
+		sampleRate := voice.SampleRateHertz
+		if sampleRate == "" {
+			sampleRate = "24000"
+		}
+		fmt.Fprintf(&b, `
+- !!org.nobody.multitts.tts.speaker.Speaker
+  avatar: ''
+  code: %s
+  desc: ''
+  extendUI: ''
+  gender: %s
+  name: %s
+  note: 'wpm: %s'
+  param: ''
+  sampleRate: %s
+  speed: 1.5
+  type: 1
+  volume: 1`, voice.ShortName, gender, voice.LocalName, voice.WordsPerMinute, sampleRate)
+	}
+	c.Data(http.StatusOK, "text/yaml; charset=utf-8", []byte(b.String()))
+}
+
+// writeVoiceNameMap 以 ShortName -> LocalName 的映射输出语音列表
+func writeVoiceNameMap(c *gin.Context, voices []utils.Voice) {
+	names := make(map[string]string, len(voices))
+	for _, voice := range voices {
+		names[voice.ShortName] = voice.LocalName
+	}
+	c.JSON(http.StatusOK, names)
+}
+
+// exportParams 生成配置时使用的合成参数
+type exportParams struct {
+	baseURL      string
+	token        string
+	voice        utils.Voice
+	pitch        string
+	outputFormat string
+	style        string
+}
+
+// ttsURL 生成指向本服务 /tts 的 URL，text 与 rate 为各应用的模板变量
+func (p exportParams) ttsURL(text, rate string) string {
+	query := url.Values{}
+	query.Set("v", p.voice.ShortName)
+	query.Set("p", p.pitch)
+	query.Set("o", p.outputFormat)
+	if p.style != "" {
+		query.Set("style", p.style)
+	}
+	// 模板变量不能被转义，直接拼接在末尾
+	return fmt.Sprintf("%s/tts?%s&r=%s&t=%s", p.baseURL, query.Encode(), rate, text)
+}
+
+func (p exportParams) authHeader() string {
+	header, _ := json.Marshal(map[string]string{"Authorization": "Bearer " + p.token})
+	return string(header)
+}
+
+func (p exportParams) displayName() string {
+	name := p.voice.LocalName
+	if name == "" {
+		name = p.voice.ShortName
+	}
+	if p.style != "" {
+		name += " (" + p.style + ")"
+	}
+	return name
+}
+
+// requestBaseURL 根据请求推断本服务的外部访问地址，X-Forwarded-Proto 和 X-Forwarded-Host
+// 只在请求来自 TRUSTED_PROXIES 中的代理时采用，避免生成指向任意主机的配置和分享链接
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	host := c.Request.Host
+	if utils.IsTrustedProxy(c.RemoteIP()) {
+		if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+			scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+		}
+		if forwarded := c.GetHeader("X-Forwarded-Host"); forwarded != "" {
+			host = strings.Split(forwarded, ",")[0]
+		}
+	}
+	return scheme + "://" + strings.TrimSpace(host)
+}
+
+// bearerToken 返回请求中携带的 token，生成的配置沿用调用方自己的 token
+func bearerToken(c *gin.Context) string {
+	parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// ExportConfig 处理 /config/:app 请求，生成可直接导入 MultiTTS、TTS-Server 和阅读的配置
+func ExportConfig(c *gin.Context) {
+	voices, err := utils.VoiceListContext(c.Request.Context())
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	voiceName := c.DefaultQuery("v", utils.DefaultVoiceName())
+	voice, ok := utils.FindVoice(voices, voiceName)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown voice %q", voiceName)})
+		return
+	}
+
+	params := exportParams{
+		baseURL:      requestBaseURL(c),
+		token:        bearerToken(c),
+		voice:        voice,
+		pitch:        c.DefaultQuery("p", "0"),
+		outputFormat: c.DefaultQuery("o", "audio-24khz-48kbitrate-mono-mp3"),
+		style:        c.Query("style"),
+	}
+	if !utils.IsSupportedOutputFormat(params.outputFormat) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported output format %q", params.outputFormat)})
+		return
+	}
+	if params.style != "" && !voice.SupportsStyle(params.style) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("voice %s does not support style %q", voice.ShortName, params.style)})
+		return
+	}
+
+	switch c.Param("app") {
+	case "legado":
+		c.Header("Content-Disposition", `attachment; filename="legado-tts.json"`)
+		c.JSON(http.StatusOK, legadoConfig(params))
+	case "tts-server":
+		c.Header("Content-Disposition", `attachment; filename="tts-server.json"`)
+		c.JSON(http.StatusOK, ttsServerConfig(params))
+	case "multitts":
+		c.Header("Content-Disposition", `attachment; filename="multitts.json"`)
+		c.JSON(http.StatusOK, multiTTSConfig(params))
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "app must be one of legado, tts-server, multitts"})
+	}
+}
+
+// legadoConfig 阅读的朗读引擎配置，speakSpeed 取值 5-50，默认 10 对应原速
+func legadoConfig(p exportParams) []gin.H {
+	now := time.Now().UnixMilli()
+	return []gin.H{{
+		"id":             now,
+		"name":           p.displayName(),
+		"url":            p.ttsURL("{{java.encodeURI(speakText)}}", "{{(speakSpeed - 10) * 2}}"),
+		"header":         p.authHeader(),
+		"contentType":    utils.ContentTypeOf(p.outputFormat),
+		"concurrentRate": "0",
+		"loginUrl":       "",
+		"loginUi":        "",
+		"loginCheckJs":   "",
+		"lastUpdateTime": now,
+	}}
+}
+
+// ttsServerConfig TTS-Server 的 HTTP 朗读配置
+func ttsServerConfig(p exportParams) []gin.H {
+	now := time.Now().UnixMilli()
+	sampleRate := 24000
+	fmt.Sscanf(p.voice.SampleRateHertz, "%d", &sampleRate)
+	return []gin.H{{
+		"group": gin.H{
+			"id":   now,
+			"name": "ms-tts-go",
+		},
+		"list": []gin.H{{
+			"id":          now + 1,
+			"displayName": p.displayName(),
+			"isEnabled":   true,
+			"tts": gin.H{
+				"#type":  "http",
+				"url":    p.ttsURL("{{java.encodeURI(speakText)}}", "{{(speakSpeed - 10) * 2}}"),
+				"header": p.authHeader(),
+				"locale": p.voice.Locale,
+				"audioFormat": gin.H{
+					"sampleRate":   sampleRate,
+					"isNeedDecode": true,
+				},
+			},
+		}},
+	}}
+}
+
+// multiTTSConfig MultiTTS 的 HTTP 引擎配置，附带所选语音的 speaker 信息
+func multiTTSConfig(p exportParams) gin.H {
+	gender := 1
+	if p.voice.Gender == "Female" {
+		gender = 0
+	}
+	return gin.H{
+		"name":    p.displayName(),
+		"url":     p.ttsURL("%{text}", "%{rate}"),
+		"method":  "GET",
+		"headers": gin.H{"Authorization": "Bearer " + p.token},
+		"speaker": gin.H{
+			"code":       p.voice.ShortName,
+			"name":       p.voice.LocalName,
+			"gender":     gender,
+			"sampleRate": p.voice.SampleRateHertz,
+			"note":       "wpm: " + p.voice.WordsPerMinute,
+		},
+	}
+}
@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"fmt"
+	"io"
 	"ms-tts-go/utils"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,35 +15,54 @@ import (
 
 var log = logrus.New()
 
+// Init 从环境变量读取 handlers 包的配置，需在加载 .env 之后调用
+func Init() {
+	audioCacheControl = "private, max-age=" + strconv.Itoa(httpCacheMaxAge())
+	maxShareTTL = shareMaxTTL()
+}
+
+// voiceFilterFromQuery 从查询参数中读取语音筛选条件
+func voiceFilterFromQuery(c *gin.Context) utils.VoiceFilter {
+	return utils.VoiceFilter{
+		Locale:         c.Query("locale"),
+		LocalePrefix:   c.Query("locale_prefix"),
+		LocaleContains: c.Query("l"),
+		Gender:         c.Query("gender"),
+		Style:          c.Query("style"),
+		Role:           c.Query("role"),
+		VoiceType:      c.Query("type"),
+		Search:         c.Query("q"),
+	}
+}
+
 func GetVoiceList(c *gin.Context) {
-	locale := c.Query("l")
-	voices, err := utils.VoiceList()
+	voices, err := utils.VoiceListContext(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
-	if locale != "" {
-		filteredVoices := make([]interface{}, 0)
-		for _, voice := range voices {
-			if strings.Contains(voice.(map[string]interface{})["Locale"].(string), locale) {
-				filteredVoices = append(filteredVoices, voice)
-			}
-		}
-		voices = filteredVoices
+	voices = utils.FilterVoices(voices, voiceFilterFromQuery(c))
+
+	// f=0 输出 MultiTTS speaker 列表，f=1 输出 ShortName -> LocalName 映射，与 worker.js 保持一致
+	switch c.Query("f") {
+	case "0":
+		writeMultiTTSSpeakers(c, voices)
+		return
+	case "1":
+		writeVoiceNameMap(c, voices)
+		return
 	}
 
 	_, detail := c.GetQuery("d")
 	if detail {
 		c.JSON(http.StatusOK, gin.H{"voices": voices})
 	} else {
-		voiceSimpleList := make([]map[string]string, 0)
+		voiceSimpleList := make([]map[string]string, 0, len(voices))
 		for _, voice := range voices {
-			localName := voice.(map[string]interface{})["LocalName"].(string)
-			shortName := voice.(map[string]interface{})["ShortName"].(string)
 			voiceSimpleList = append(voiceSimpleList, map[string]string{
-				"LocalName": localName,
-				"ShortName": shortName,
+				"LocalName": voice.LocalName,
+				"ShortName": voice.ShortName,
 			})
 		}
 		c.JSON(http.StatusOK, gin.H{"voices": voiceSimpleList})
@@ -61,31 +82,96 @@ type SynthesizeVoiceRequest struct {
 	Rate         string `json:"r"`
 	Pitch        string `json:"p"`
 	OutputFormat string `json:"o"`
+	Style        string `json:"style"`
+	StyleDegree  string `json:"styledegree"`
+	Role         string `json:"role"`
+	Volume       string `json:"volume"`
+	Lang         string `json:"lang"`
+	// Raw 为 true 时 t 作为 SSML 片段嵌入，不做转义
+	Raw bool `json:"raw"`
+	// Sub 字幕格式 (srt、vtt、json)，Bundle 为音频与字幕的打包方式 (zip、multipart)
+	Sub     string `json:"sub"`
+	Bundle  string `json:"bundle"`
+	MaxLine int    `json:"max_line"`
+}
+
+func (r SynthesizeVoiceRequest) speechOptions() utils.SpeechOptions {
+	return utils.SpeechOptions{
+		Text:         r.Text,
+		VoiceName:    r.VoiceName,
+		Rate:         r.Rate,
+		Pitch:        r.Pitch,
+		OutputFormat: r.OutputFormat,
+		Style:        r.Style,
+		StyleDegree:  r.StyleDegree,
+		Role:         r.Role,
+		Volume:       r.Volume,
+		Lang:         r.Lang,
+		RawSSML:      r.Raw,
+	}
+}
+
+func (r SynthesizeVoiceRequest) subtitleRequest() subtitleRequest {
+	return subtitleRequest{format: r.Sub, bundle: r.Bundle, maxLine: r.MaxLine}
+}
+
+// speechOptionsFromQuery 从 /tts 的查询参数中读取合成参数
+func speechOptionsFromQuery(c *gin.Context) utils.SpeechOptions {
+	return utils.SpeechOptions{
+		Text:         c.Query("t"),
+		VoiceName:    c.DefaultQuery("v", utils.DefaultVoiceName()),
+		Rate:         c.DefaultQuery("r", "0"),
+		Pitch:        c.DefaultQuery("p", "0"),
+		OutputFormat: c.DefaultQuery("o", "audio-24khz-48kbitrate-mono-mp3"),
+		Style:        c.Query("style"),
+		StyleDegree:  c.Query("styledegree"),
+		Role:         c.Query("role"),
+		Volume:       c.Query("volume"),
+		Lang:         c.Query("lang"),
+		RawSSML:      c.Query("raw") == "true" || c.Query("raw") == "1",
+	}
 }
 
 func SynthesizeVoice(c *gin.Context) {
-	text := c.Query("t")
-	if text == "" {
+	opts := speechOptionsFromQuery(c)
+	if opts.Text == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Text is required"})
 		return
 	}
 
-	voiceName := c.DefaultQuery("v", "zh-CN-XiaoxiaoMultilingualNeural")
-	rate := c.DefaultQuery("r", "0")
-	pitch := c.DefaultQuery("p", "0")
-	outputFormat := c.DefaultQuery("o", "audio-24khz-48kbitrate-mono-mp3")
+	log.Infof("Synthesizing voice. Text: %s, Voice: %s, Rate: %s, Pitch: %s, Format: %s, Style: %s, Role: %s",
+		opts.Text, opts.VoiceName, opts.Rate, opts.Pitch, opts.OutputFormat, opts.Style, opts.Role)
 
-	log.Infof("Synthesizing voice. Text: %s, Voice: %s, Rate: %s, Pitch: %s, Format: %s", text, voiceName, rate, pitch, outputFormat)
+	// 指定字幕格式时与音频一起打包返回，默认为 zip
+	if sub := subtitleRequestFromQuery(c); sub.format != "" {
+		if sub.bundle == bundleNone {
+			sub.bundle = bundleZip
+		}
+		writeSubtitles(c, opts, sub)
+		return
+	}
 
-	voice, err := utils.GetVoice(text, voiceName, rate, pitch, outputFormat)
+	charge, err := authorizeSpeech(c, textChars(opts.Text), opts.VoiceName)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	// 相同参数的音频不变，客户端已有副本时无需合成，也不计入字符；
+	// 放在权限检查之后，没有权限的 key 无法借 304 探测缓存
+	if notModified(c, opts) {
+		charge.refund()
+		return
+	}
+
+	body, cache, err := utils.SynthesizeCached(c.Request.Context(), opts)
 	if err != nil {
 		log.Errorf("Failed to synthesize voice: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		charge.refund()
+		writeError(c, err)
 		return
 	}
 
-	log.Infof("Voice synthesized successfully. Size: %s", utils.ByteCountIEC(int64(len(voice))))
-	c.Data(http.StatusOK, "audio/mpeg", voice)
+	serveAudio(c, audioContentType(opts.OutputFormat), body, cache, charge)
 }
 
 func SynthesizeVoicePost(c *gin.Context) {
@@ -103,15 +189,125 @@ func SynthesizeVoicePost(c *gin.Context) {
 	log.Infof("Synthesizing voice (POST). Text: %s, Voice: %s, Rate: %s, Pitch: %s, Format: %s",
 		request.Text, request.VoiceName, request.Rate, request.Pitch, request.OutputFormat)
 
-	voice, err := utils.GetVoice(request.Text, request.VoiceName, request.Rate, request.Pitch, request.OutputFormat)
+	if sub := request.subtitleRequest(); sub.format != "" {
+		if sub.bundle == bundleNone {
+			sub.bundle = bundleZip
+		}
+		writeSubtitles(c, request.speechOptions(), sub)
+		return
+	}
+
+	charge, err := authorizeSpeech(c, textChars(request.Text), request.VoiceName)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	body, cache, err := utils.SynthesizeCached(c.Request.Context(), request.speechOptions())
+	if err != nil {
+		log.Errorf("Failed to synthesize voice: %v", err)
+		charge.refund()
+		writeError(c, err)
+		return
+	}
+
+	setCacheHeader(c, cache)
+	streamAudio(c, audioContentType(request.OutputFormat), body)
+}
+
+// maxSsmlSize SSML 请求体的最大长度
+const maxSsmlSize = 1 << 20
+
+// SynthesizeSsml 处理 POST /ssml 请求，请求体为完整的 SSML 文档
+func SynthesizeSsml(c *gin.Context) {
+	switch strings.TrimSpace(strings.Split(c.ContentType(), ";")[0]) {
+	case "application/ssml+xml", "application/xml", "text/xml":
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/ssml+xml"})
+		return
+	}
+
+	doc, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSsmlSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(doc) > maxSsmlSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "SSML document is too large"})
+		return
+	}
+
+	// 输出格式可通过查询参数 o 或 X-Microsoft-OutputFormat 请求头指定
+	outputFormat := c.Query("o")
+	if outputFormat == "" {
+		outputFormat = c.GetHeader("X-Microsoft-OutputFormat")
+	}
+
+	log.Infof("Synthesizing voice (SSML). Size: %s, Format: %s", utils.ByteCountIEC(int64(len(doc))), outputFormat)
+
+	voices, chars, err := utils.InspectSsmlDocument(string(doc))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	charge, err := authorizeSpeech(c, chars, voices...)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	body, err := utils.SynthesizeSsmlDocumentStream(c.Request.Context(), string(doc), outputFormat)
 	if err != nil {
 		log.Errorf("Failed to synthesize voice: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		charge.refund()
+		writeError(c, err)
 		return
 	}
 
-	log.Infof("Voice synthesized successfully. Size: %s", utils.ByteCountIEC(int64(len(voice))))
-	c.Data(http.StatusOK, "audio/mpeg", voice)
+	streamAudio(c, audioContentType(outputFormat), body)
+}
+
+// audioContentType 返回输出格式对应的 Content-Type，未指定时按默认格式
+func audioContentType(outputFormat string) string {
+	if outputFormat == "" {
+		outputFormat = utils.DefaultOutputFormat()
+	}
+	return utils.ContentTypeOf(outputFormat)
+}
+
+// streamAudio 将上游音频边收边转发给客户端，上游请求绑定了客户端的 ctx，断开时读取会立即返回
+func streamAudio(c *gin.Context, contentType string, body io.ReadCloser) {
+	defer body.Close()
+
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+
+	var written int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := c.Writer.Write(buf[:n]); werr != nil {
+				log.Warnf("Client disconnected while streaming: %v", werr)
+				return
+			}
+			c.Writer.Flush()
+			written += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if c.Request.Context().Err() != nil {
+				log.Warnf("Client disconnected while streaming, sent: %s", utils.ByteCountIEC(written))
+			} else {
+				log.Errorf("Error reading upstream stream: %v", err)
+			}
+			return
+		}
+	}
+
+	log.Infof("Voice synthesized successfully. Size: %s", utils.ByteCountIEC(written))
 }
 
 // OpenAIModel 结构体用于表示 OpenAI 模型格式
@@ -130,26 +326,33 @@ type OpenAIModelList struct {
 
 // GetModels 处理 /v1/models 请求
 func GetModels(c *gin.Context) {
-	voices, err := utils.VoiceList()
+	voices, err := utils.VoiceListContext(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": gin.H{
-				"message": "Failed to retrieve voice list",
-				"type":    "server_error",
-				"param":   "",
-				"code":    "",
-			},
-		})
+		writeOpenAIError(c, err, "Failed to retrieve voice list")
 		return
 	}
 
+	filter := voiceFilterFromQuery(c)
+	voices = utils.FilterVoices(voices, filter)
+
 	models := make([]OpenAIModel, 0, len(voices))
 	creationTime := int(time.Now().Unix())
 
+	// 未筛选时，OpenAI 的模型名称和语音别名排在微软语音之前
+	if filter == (utils.VoiceFilter{}) {
+		for _, name := range append(utils.OpenAIModelNames(), utils.VoiceAliasNames()...) {
+			models = append(models, OpenAIModel{
+				ID:      name,
+				Object:  "model",
+				Created: creationTime,
+				OwnedBy: "ms-tts-go",
+			})
+		}
+	}
+
 	for _, voice := range voices {
-		v := voice.(map[string]interface{})
 		model := OpenAIModel{
-			ID:      v["ShortName"].(string),
+			ID:      voice.ShortName,
 			Object:  "model",
 			Created: creationTime,
 			OwnedBy: "microsoft",
@@ -179,6 +382,22 @@ type CreateSpeechRequest struct {
     ResponseFormat string  `json:"response_format"`
     Speed          float64 `json:"speed,omitempty"`
     Stream         *bool   `json:"stream,omitempty"` // 使用指针类型来区分未设置和设置为false
+    Instructions   string  `json:"instructions,omitempty"`
+    StreamFormat   string  `json:"stream_format,omitempty"` // audio 或 sse
+    // 以下为 Azure 扩展参数
+    Style       string   `json:"style,omitempty"`
+    StyleDegree *float64 `json:"styledegree,omitempty"`
+    Role        string   `json:"role,omitempty"`
+    Volume      *float64 `json:"volume,omitempty"`
+    Lang        string   `json:"lang,omitempty"`
+}
+
+// formatOptionalFloat 将可选的数字参数转换为字符串，未设置时返回空字符串
+func formatOptionalFloat(value *float64) string {
+    if value == nil {
+        return ""
+    }
+    return strconv.FormatFloat(*value, 'f', -1, 64)
 }
 
 // CreateSpeech 处理 /v1/audio/speech 请求
@@ -225,31 +444,72 @@ func CreateSpeech(c *gin.Context) {
     // 将 rate 转换为字符串
     rateStr := fmt.Sprintf("%d", rate)
 
+    if request.StreamFormat != "" && request.StreamFormat != "audio" && request.StreamFormat != "sse" {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error": gin.H{
+                "message": "stream_format must be audio or sse",
+                "type":    "invalid_request_error",
+                "param":   "stream_format",
+                "code":    "invalid_value",
+            },
+        })
+        return
+    }
+
+    // 将 OpenAI 的 response_format 转换为上游输出格式
+    format, err := utils.ResolveOpenAIFormat(request.ResponseFormat, utils.IsHDModel(request.Model))
+    if err != nil {
+        writeOpenAIError(c, err, "Unsupported response_format")
+        return
+    }
+
     // 处理 stream 参数，默认为 true
     useStream := true
     if request.Stream != nil && !*request.Stream {
         useStream = false
     }
 
+    // 将 alloy 等 OpenAI 语音名称转换为微软语音，未指定语音时允许把 /v1/models 中的语音名作为 model
+    voiceName := request.Voice
+    if voiceName == "" && !utils.IsOpenAIModel(request.Model) {
+        voiceName = request.Model
+    }
+    voiceName = utils.ResolveVoiceAlias(voiceName, request.Lang, request.Input)
+
+    opts := utils.SpeechOptions{
+        Text:         request.Input,
+        VoiceName:    voiceName,
+        Rate:         rateStr,
+        Pitch:        "0",
+        OutputFormat: format.OutputFormat,
+        Style:        request.Style,
+        StyleDegree:  formatOptionalFloat(request.StyleDegree),
+        Role:         request.Role,
+        Volume:       formatOptionalFloat(request.Volume),
+        Lang:         request.Lang,
+    }
+    charge, err := authorizeSpeech(c, textChars(request.Input), voiceName)
+    if err != nil {
+        writeOpenAIError(c, err, "Not allowed to synthesize speech")
+        return
+    }
+
+    // 将 instructions 转换为说话风格和韵律参数
+    opts = utils.ApplyInstructions(c.Request.Context(), opts, request.Instructions)
+
     // 生成语音
-    voice, err := utils.GetVoice(request.Input, request.Voice, rateStr, "0", request.ResponseFormat)
+    body, cache, err := utils.SynthesizeCached(c.Request.Context(), opts)
     if err != nil {
         log.Errorf("Failed to synthesize voice: %v", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "error": gin.H{
-                "message": "Failed to synthesize speech",
-                "type":    "server_error",
-                "param":   "",
-                "code":    "",
-            },
-        })
+        charge.refund()
+        writeOpenAIError(c, err, "Failed to synthesize speech")
         return
     }
+    setCacheHeader(c, cache)
 
-    contentType := "audio/mpeg"
-    if request.ResponseFormat == "opus" {
-        contentType = "audio/opus"
-    }
+    // 上游没有对应格式时在本地封装
+    body = utils.WrapAudioStream(body, format.Wrap, format.SampleRate)
+    contentType := format.ContentType
 
     // 添加 OpenAI 风格的响应头
     c.Header("OpenAI-Organization", "microsoft-organization-id")
@@ -257,31 +517,37 @@ func CreateSpeech(c *gin.Context) {
     c.Header("OpenAI-Version", "2023-05-15")
     c.Header("X-Request-ID", utils.GenerateRequestID())
 
-    log.Infof("Voice synthesized successfully. Size: %s", utils.ByteCountIEC(int64(len(voice))))
+    if request.StreamFormat == "sse" {
+        // SSE 响应，音频以 base64 事件输出
+        streamSpeechEvents(c, body, request.Input)
+        return
+    }
 
     if useStream {
-        // 流式响应
-        c.Header("Content-Type", contentType)
-        c.Header("Transfer-Encoding", "chunked")
-        c.Status(http.StatusOK)
-
-        // 模拟流式传输，每次发送一小块数据
-        chunkSize := 1024 // 可以根据需要调整
-        for i := 0; i < len(voice); i += chunkSize {
-            end := i + chunkSize
-            if end > len(voice) {
-                end = len(voice)
-            }
-            _, err := c.Writer.Write(voice[i:end])
-            if err != nil {
-                log.Errorf("Error writing stream: %v", err)
-                return
-            }
-            c.Writer.Flush()
-            time.Sleep(10 * time.Millisecond) // 模拟处理时间，可以根据需要调整
-        }
-    } else {
-        // 非流式响应，一次性发送所有数据
-        c.Data(http.StatusOK, contentType, voice)
+        // 流式响应，直接转发上游数据
+        streamAudio(c, contentType, body)
+        return
     }
+
+    // 非流式响应，一次性发送所有数据
+    defer body.Close()
+    voice, err := io.ReadAll(body)
+    if err != nil {
+        log.Errorf("Failed to read voice: %v", err)
+        charge.refund()
+        writeOpenAIError(c, err, "Failed to read synthesized speech")
+        return
+    }
+    log.Infof("Voice synthesized successfully. Size: %s", utils.ByteCountIEC(int64(len(voice))))
+    c.Data(http.StatusOK, contentType, voice)
+}
+
+// GetStatus 返回服务的诊断信息
+func GetStatus(c *gin.Context) {
+    c.JSON(http.StatusOK, gin.H{
+        "endpoint":  utils.GetTokenState(),
+        "providers": utils.GetProviderStates(),
+        "voices":    utils.GetVoiceCacheState(),
+        "audio":     utils.GetAudioCacheState(),
+    })
 }
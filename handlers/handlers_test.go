@@ -0,0 +1,452 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"ms-tts-go/fakeupstream"
+	"ms-tts-go/utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// upstream 所有测试共用的模拟上游服务
+var upstream *fakeupstream.Server
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	log.SetOutput(io.Discard)
+	utils.SetLogLevel(logrus.PanicLevel)
+
+	// 音频缓存和语音列表缓存使用相对路径，在临时目录中运行以免写入源码目录
+	dir, err := os.MkdirTemp("", "handlers-test")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+
+	upstream = fakeupstream.New()
+	utils.SetUpstreamURLs(upstream.URLs())
+
+	code := m.Run()
+	upstream.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestRouter 注册与 routes.SetupRouter 相同的处理函数，不经过认证和限流
+func newTestRouter() *gin.Engine {
+	router := gin.New()
+	router.GET("/voices", GetVoiceList)
+	router.POST("/tts", SynthesizeVoicePost)
+	router.GET("/tts", SynthesizeVoice)
+	router.POST("/ssml", SynthesizeSsml)
+	router.GET("/subtitles", SynthesizeSubtitles)
+	router.POST("/subtitles", SynthesizeSubtitles)
+	router.POST("/v1/audio/speech", CreateSpeech)
+	return router
+}
+
+// serve 发送请求并返回响应，body 不为空时 contentType 为请求体的类型
+func serve(method, target, contentType, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, req)
+	return w
+}
+
+// upstreamRequests 模拟服务收到的请求总数
+func upstreamRequests() int {
+	total := 0
+	for _, path := range []string{
+		fakeupstream.PathEndpoint,
+		fakeupstream.PathVoices,
+		fakeupstream.PathIssueToken,
+		fakeupstream.PathSynthesize,
+		fakeupstream.PathWebSocket,
+	} {
+		total += upstream.Requests(path)
+	}
+	return total
+}
+
+func TestInvalidInputRejectedBeforeUpstream(t *testing.T) {
+	const ssmlType = "application/ssml+xml"
+	const jsonType = "application/json"
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+	}{
+		{"GET /tts control character", http.MethodGet, "/tts?t=a%00b", "", ""},
+		{"GET /tts invalid utf-8", http.MethodGet, "/tts?t=a%FFb", "", ""},
+		{"GET /tts raw voice injection", http.MethodGet, "/tts?raw=1&t=%3Cvoice+name%3D%22x%22%3Ey%3C%2Fvoice%3E", "", ""},
+		{"GET /tts raw unbalanced end tag", http.MethodGet, "/tts?raw=1&t=%3C%2Fprosody%3Ex%3Cprosody%3E", "", ""},
+		{"GET /tts rate injection", http.MethodGet, "/tts?t=hello&r=10%22+pitch%3D%2250", "", ""},
+		{"POST /tts control character", http.MethodPost, "/tts", jsonType, `{"t": "a\u0001b"}`},
+		{"POST /tts raw speak injection", http.MethodPost, "/tts", jsonType, `{"t": "</speak><speak>x", "raw": true}`},
+		{"POST /tts raw processing instruction", http.MethodPost, "/tts", jsonType, `{"t": "<?xml-stylesheet href=\"x\"?>", "raw": true}`},
+		{"POST /ssml doctype", http.MethodPost, "/ssml", ssmlType,
+			`<!DOCTYPE speak [<!ENTITY x "boom">]><speak version="1.0" xmlns="http://www.w3.org/2001/10/synthesis" xml:lang="en-US">&x;</speak>`},
+		{"POST /ssml malformed", http.MethodPost, "/ssml", ssmlType,
+			`<speak version="1.0" xmlns="http://www.w3.org/2001/10/synthesis" xml:lang="en-US">a & b</speak>`},
+		{"GET /subtitles control character", http.MethodGet, "/subtitles?t=a%1Bb", "", ""},
+		{"POST /v1/audio/speech control character", http.MethodPost, "/v1/audio/speech", jsonType,
+			`{"model": "tts-1", "input": "a\u0000b", "voice": "alloy"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := upstreamRequests()
+			w := serve(tt.method, tt.target, tt.contentType, tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400, body: %s", w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), "error") {
+				t.Errorf("body has no error message: %s", w.Body.String())
+			}
+			if after := upstreamRequests(); after != before {
+				t.Errorf("invalid input made %d upstream requests", after-before)
+			}
+		})
+	}
+}
+
+// failUpstream 让模拟服务的 path 返回 status，测试结束时恢复
+func failUpstream(t *testing.T, path string, status int) {
+	t.Helper()
+	upstream.Fail(path, status)
+	t.Cleanup(func() { upstream.Fail(path, 0) })
+}
+
+func TestGetVoiceList(t *testing.T) {
+	w := serve(http.MethodGet, "/voices?l=en-US", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Voices []map[string]string `json:"voices"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	want := 0
+	for _, voice := range fakeupstream.Voices() {
+		if voice.Locale == "en-US" {
+			want++
+		}
+	}
+	if len(response.Voices) != want || want == 0 {
+		t.Fatalf("got %d en-US voices, want %d", len(response.Voices), want)
+	}
+	for _, voice := range response.Voices {
+		if !strings.HasPrefix(voice["ShortName"], "en-US-") {
+			t.Errorf("filter returned %s", voice["ShortName"])
+		}
+	}
+}
+
+func TestSynthesizeVoice(t *testing.T) {
+	target := "/tts?t=get+synthesis+test&v=en-US-JennyNeural&o=riff-24khz-16bit-mono-pcm"
+	before := upstream.Requests(fakeupstream.PathSynthesize)
+
+	w := serve(http.MethodGet, target, "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "audio/wav" {
+		t.Errorf("Content-Type = %q, want audio/wav", got)
+	}
+	if got := w.Header().Get("X-Cache"); got != "MISS" {
+		t.Errorf("X-Cache = %q, want MISS", got)
+	}
+	if !bytes.HasPrefix(w.Body.Bytes(), []byte("RIFF")) {
+		t.Errorf("body is not a wav file")
+	}
+	etag := w.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) {
+		t.Errorf("ETag = %q, want a weak validator", etag)
+	}
+
+	// 相同参数的第二次请求来自缓存，内容一致
+	again := serve(http.MethodGet, target, "", "")
+	if again.Header().Get("X-Cache") != "HIT" || !bytes.Equal(again.Body.Bytes(), w.Body.Bytes()) {
+		t.Errorf("second request: X-Cache = %q, same body = %v", again.Header().Get("X-Cache"), bytes.Equal(again.Body.Bytes(), w.Body.Bytes()))
+	}
+	if got := upstream.Requests(fakeupstream.PathSynthesize) - before; got != 1 {
+		t.Errorf("made %d synthesis requests, want 1", got)
+	}
+
+	notModified := serve(http.MethodGet, target, "", "", "If-None-Match", etag)
+	if notModified.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match status = %d, want 304", notModified.Code)
+	}
+
+	partial := serve(http.MethodGet, target, "", "", "Range", "bytes=0-3")
+	if partial.Code != http.StatusPartialContent || partial.Body.String() != "RIFF" {
+		t.Errorf("Range status = %d, body = %q", partial.Code, partial.Body.String())
+	}
+}
+
+func TestSynthesizeVoicePost(t *testing.T) {
+	w := serve(http.MethodPost, "/tts", "application/json", `{"t": "post synthesis test", "v": "en-US-AriaNeural", "style": "cheerful"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "audio/mpeg" {
+		t.Errorf("Content-Type = %q, want audio/mpeg", got)
+	}
+	if w.Body.Len() == 0 {
+		t.Errorf("empty audio")
+	}
+}
+
+func TestSynthesizeSsml(t *testing.T) {
+	doc := `<speak version="1.0" xmlns="http://www.w3.org/2001/10/synthesis" xml:lang="en-US">` +
+		`<voice name="en-US-JennyNeural">ssml document test</voice></speak>`
+	w := serve(http.MethodPost, "/ssml?o=ogg-24khz-16bit-mono-opus", "application/ssml+xml", doc)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "audio/ogg" {
+		t.Errorf("Content-Type = %q, want audio/ogg", got)
+	}
+	if w.Body.Len() == 0 {
+		t.Errorf("empty audio")
+	}
+
+	unsupported := serve(http.MethodPost, "/ssml", "text/plain", doc)
+	if unsupported.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("text/plain status = %d, want 415", unsupported.Code)
+	}
+}
+
+func TestCreateSpeech(t *testing.T) {
+	w := serve(http.MethodPost, "/v1/audio/speech", "application/json",
+		`{"model": "tts-1", "input": "openai speech test", "voice": "alloy", "response_format": "wav", "stream": false}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "audio/wav" {
+		t.Errorf("Content-Type = %q, want audio/wav", got)
+	}
+	if !bytes.HasPrefix(w.Body.Bytes(), []byte("RIFF")) {
+		t.Errorf("body is not a wav file")
+	}
+
+	unsupported := serve(http.MethodPost, "/v1/audio/speech", "application/json",
+		`{"model": "tts-1", "input": "openai speech test", "voice": "alloy", "response_format": "midi"}`)
+	assertOpenAIError(t, unsupported, http.StatusBadRequest, "unsupported_response_format")
+
+	// 上游没有 AAC，不能以 MP3 代替
+	aac := serve(http.MethodPost, "/v1/audio/speech", "application/json",
+		`{"model": "tts-1", "input": "openai speech test", "voice": "alloy", "response_format": "aac"}`)
+	assertOpenAIError(t, aac, http.StatusBadRequest, "unsupported_response_format")
+}
+
+// assertOpenAIError 检查 OpenAI 风格的错误响应
+func assertOpenAIError(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d, body: %s", w.Code, status, w.Body.String())
+	}
+	var response struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+			Code    string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if response.Error.Code != code || response.Error.Message == "" || response.Error.Type == "" {
+		t.Errorf("error = %+v, want code %s", response.Error, code)
+	}
+}
+
+func TestUpstreamFailures(t *testing.T) {
+	tests := []struct {
+		status     int
+		want       int
+		code       string
+		retryAfter string
+	}{
+		{http.StatusTooManyRequests, http.StatusTooManyRequests, "rate_limit_exceeded", "1"},
+		{http.StatusServiceUnavailable, http.StatusBadGateway, "upstream_unavailable", "1"},
+		{http.StatusUnauthorized, http.StatusBadGateway, "upstream_auth_failed", ""},
+		{http.StatusBadRequest, http.StatusBadRequest, "invalid_ssml", ""},
+	}
+
+	for i, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			failUpstream(t, fakeupstream.PathSynthesize, tt.status)
+
+			// 每次使用不同的文本，避免命中音频缓存
+			w := serve(http.MethodGet, "/tts?t=failure+test+"+strconv.Itoa(i), "", "")
+			if w.Code != tt.want {
+				t.Errorf("GET /tts status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.retryAfter {
+				t.Errorf("GET /tts Retry-After = %q, want %q", got, tt.retryAfter)
+			}
+
+			speech := serve(http.MethodPost, "/v1/audio/speech", "application/json",
+				`{"model": "tts-1", "input": "openai failure test `+strconv.Itoa(i)+`", "voice": "alloy"}`)
+			assertOpenAIError(t, speech, tt.want, tt.code)
+		})
+	}
+
+	// 上游恢复后使用重新获取的 token 继续合成
+	w := serve(http.MethodGet, "/tts?t=recovered+after+failures", "", "")
+	if w.Code != http.StatusOK {
+		t.Errorf("status after recovery = %d, body: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestEndpointFailure(t *testing.T) {
+	utils.SetUpstreamURLs(upstream.URLs())
+	t.Cleanup(func() { utils.SetUpstreamURLs(upstream.URLs()) })
+	failUpstream(t, fakeupstream.PathEndpoint, http.StatusInternalServerError)
+
+	before := upstream.Requests(fakeupstream.PathEndpoint)
+	for i := 0; i < 3; i++ {
+		w := serve(http.MethodGet, "/tts?t=endpoint+failure+"+strconv.Itoa(i), "", "")
+		if w.Code < 500 {
+			t.Errorf("status = %d, want 5xx", w.Code)
+		}
+	}
+	// 刷新失败后在退避时间内不再请求端点
+	if got := upstream.Requests(fakeupstream.PathEndpoint) - before; got != 1 {
+		t.Errorf("made %d endpoint requests, want 1", got)
+	}
+}
+
+// TestVoiceListFailureBackoff 语音列表获取失败后，退避时间内的请求不再访问语音列表接口
+func TestVoiceListFailureBackoff(t *testing.T) {
+	utils.SetUpstreamURLs(upstream.URLs())
+	t.Cleanup(func() { utils.SetUpstreamURLs(upstream.URLs()) })
+	failUpstream(t, fakeupstream.PathVoices, http.StatusServiceUnavailable)
+
+	before := upstream.Requests(fakeupstream.PathVoices)
+	if w := serve(http.MethodGet, "/voices", "", ""); w.Code < 500 {
+		t.Fatalf("first request: status = %d, want 5xx", w.Code)
+	}
+	attempts := upstream.Requests(fakeupstream.PathVoices) - before
+	if attempts == 0 {
+		t.Fatal("voice list was not requested")
+	}
+
+	if w := serve(http.MethodGet, "/voices", "", ""); w.Code < 500 {
+		t.Errorf("second request: status = %d, want 5xx", w.Code)
+	}
+	if got := upstream.Requests(fakeupstream.PathVoices) - before; got != attempts {
+		t.Errorf("second request made %d more voice list requests, want 0", got-attempts)
+	}
+
+	// 合成不依赖语音列表，区域从语音名称推断
+	w := serve(http.MethodGet, "/tts?t=no+voice+list&v=en-US-GuyNeural", "", "")
+	if w.Code != http.StatusOK {
+		t.Errorf("synthesis without voice list: status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if got := upstream.Requests(fakeupstream.PathVoices) - before; got != attempts {
+		t.Errorf("synthesis made %d voice list requests, want 0", got-attempts)
+	}
+}
+
+// TestNotModifiedRequiresAuthorization 304 只返回给有权使用该语音的 key，且不计入配额
+func TestNotModifiedRequiresAuthorization(t *testing.T) {
+	target := "/tts?t=conditional+request+test&v=en-US-GuyNeural"
+	etag := serve(http.MethodGet, target, "", "").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("missing ETag")
+	}
+
+	conditional := func(allowedVoices []string) (*httptest.ResponseRecorder, utils.APIKeyInfo) {
+		_, info, err := utils.APIKeys().Create(utils.NewAPIKey{
+			Label:         "conditional",
+			Scopes:        []string{utils.ScopeTTS},
+			DailyChars:    1000,
+			AllowedVoices: allowedVoices,
+		})
+		if err != nil {
+			t.Fatalf("create key: %v", err)
+		}
+		key, err := utils.APIKeys().Lookup(info.ID)
+		if err != nil {
+			t.Fatalf("lookup key: %v", err)
+		}
+
+		router := gin.New()
+		router.GET("/tts", func(c *gin.Context) { c.Set(utils.ContextAPIKey, key) }, SynthesizeVoice)
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("If-None-Match", etag)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		for _, k := range utils.APIKeys().List() {
+			if k.ID == info.ID {
+				info = k
+			}
+		}
+		return w, info
+	}
+
+	if w, _ := conditional([]string{"en-US-AriaNeural"}); w.Code != http.StatusForbidden {
+		t.Errorf("restricted key: status = %d, want 403", w.Code)
+	}
+
+	w, info := conditional(nil)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("allowed key: status = %d, want 304", w.Code)
+	}
+	if info.UsedToday != 0 {
+		t.Errorf("304 charged %d characters", info.UsedToday)
+	}
+}
+
+// TestShareURLIgnoresUntrustedForwardedHeaders 不是来自受信任代理的 X-Forwarded-* 头不影响生成的链接
+func TestShareURLIgnoresUntrustedForwardedHeaders(t *testing.T) {
+	key := &utils.APIKey{ID: "share-test", Scopes: []string{utils.ScopeTTS}}
+	router := gin.New()
+	router.POST("/tts/share", func(c *gin.Context) { c.Set(utils.ContextAPIKey, key) }, CreateShareURL)
+
+	req := httptest.NewRequest(http.MethodPost, "/tts/share", strings.NewReader(`{"t": "share me"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "attacker.example")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if want := "http://" + req.Host + "/tts?"; !strings.HasPrefix(response.URL, want) {
+		t.Errorf("url = %q, want prefix %q", response.URL, want)
+	}
+}
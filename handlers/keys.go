@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"fmt"
+	"ms-tts-go/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestKey 返回 AuthMiddleware 认证通过的 key，未经过认证时返回 nil
+func requestKey(c *gin.Context) *utils.APIKey {
+	value, ok := c.Get(utils.ContextAPIKey)
+	if !ok {
+		return nil
+	}
+	key, _ := value.(*utils.APIKey)
+	return key
+}
+
+// speechCharge 一次合成计入限流和每日配额的字符数
+type speechCharge struct {
+	keyID string
+	ip    string
+	chars int
+}
+
+// refund 退回计入的字符，用于参数校验失败或上游出错等没有合成出音频的情况，charge 为 nil 时不做任何事
+func (charge *speechCharge) refund() {
+	if charge == nil {
+		return
+	}
+	utils.RefundCharacters(charge.keyID, charge.ip, charge.chars)
+	utils.APIKeys().RefundChars(charge.keyID, charge.chars)
+}
+
+// authorizeSpeech 检查当前 key 能否使用这些语音，按 key 和客户端 IP 计入字符限流，并从每日配额中扣除 chars 个字符；
+// 之后的合成失败时调用方需调用返回值的 refund
+func authorizeSpeech(c *gin.Context, chars int, voices ...string) (*speechCharge, error) {
+	key := requestKey(c)
+	if key == nil {
+		return nil, nil
+	}
+	for _, voice := range voices {
+		if voice == "" {
+			voice = utils.DefaultVoiceName()
+		}
+		if !key.AllowsVoice(voice) {
+			return nil, fmt.Errorf("%w: %s", utils.ErrVoiceNotAllowed, voice)
+		}
+	}
+
+	ip := c.ClientIP()
+	limit, err := utils.AllowCharacters(key.ID, ip, chars)
+	for name, value := range limit.Headers(utils.RateLimitCharacters) {
+		c.Header(name, value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.APIKeys().ConsumeChars(key.ID, chars); err != nil {
+		utils.RefundCharacters(key.ID, ip, chars)
+		return nil, err
+	}
+	return &speechCharge{keyID: key.ID, ip: ip, chars: chars}, nil
+}
+
+// textChars 按字符 (而不是字节) 计算文本长度
+func textChars(text string) int {
+	return len([]rune(text))
+}
+
+// CreateKeyRequest 创建 API key 的请求
+type CreateKeyRequest struct {
+	Label  string   `json:"label"`
+	Scopes []string `json:"scopes"`
+	// ExpiresAt 与 ExpiresIn (秒) 二选一，都为空时不过期
+	ExpiresAt     *time.Time `json:"expires_at"`
+	ExpiresIn     int64      `json:"expires_in"`
+	DailyChars    int        `json:"daily_chars"`
+	AllowedVoices []string   `json:"allowed_voices"`
+}
+
+// ListKeys 处理 GET /admin/keys，返回全部 key (不含密钥)
+func ListKeys(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"keys": utils.APIKeys().List()})
+}
+
+// CreateKey 处理 POST /admin/keys，明文密钥只在创建时返回一次
+func CreateKey(c *gin.Context) {
+	var request CreateKeyRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	expiresAt := request.ExpiresAt
+	if expiresAt == nil && request.ExpiresIn > 0 {
+		t := time.Now().UTC().Add(time.Duration(request.ExpiresIn) * time.Second)
+		expiresAt = &t
+	}
+
+	secret, info, err := utils.APIKeys().Create(utils.NewAPIKey{
+		Label:         request.Label,
+		Scopes:        request.Scopes,
+		ExpiresAt:     expiresAt,
+		DailyChars:    request.DailyChars,
+		AllowedVoices: request.AllowedVoices,
+	})
+	if err != nil {
+		log.Errorf("Failed to create api key: %v", err)
+		writeError(c, err)
+		return
+	}
+
+	log.Infof("API key created. ID: %s, Label: %s, Scopes: %v", info.ID, info.Label, info.Scopes)
+	c.JSON(http.StatusCreated, gin.H{"key": secret, "info": info})
+}
+
+// RevokeKey 处理 DELETE /admin/keys/:id
+func RevokeKey(c *gin.Context) {
+	info, err := utils.APIKeys().Revoke(c.Param("id"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	log.Infof("API key revoked. ID: %s, Label: %s", info.ID, info.Label)
+	c.JSON(http.StatusOK, gin.H{"info": info})
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"ms-tts-go/utils"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 签名链接默认 1 天后过期，最长有效期通过 SHARE_MAX_TTL (秒) 配置
+const defaultShareTTL = 24 * time.Hour
+
+// maxShareTTL 签名链接的最长有效期，在 Init 中按 SHARE_MAX_TTL 设置
+var maxShareTTL = 30 * 24 * time.Hour
+
+func shareMaxTTL() time.Duration {
+	value := os.Getenv("SHARE_MAX_TTL")
+	if value == "" {
+		return 30 * 24 * time.Hour
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		log.Warnf("Invalid SHARE_MAX_TTL %q, using default 30 days", value)
+		return 30 * 24 * time.Hour
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// ShareRequest 生成签名链接的请求，合成参数与 POST /tts 相同
+type ShareRequest struct {
+	SynthesizeVoiceRequest
+	// ExpiresIn 链接的有效期 (秒)，默认 1 天
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+// query 将合成参数转换为 GET /tts 的查询参数，空值不写入
+func (r ShareRequest) query() url.Values {
+	query := url.Values{}
+	for name, value := range map[string]string{
+		"t":           r.Text,
+		"v":           r.VoiceName,
+		"r":           r.Rate,
+		"p":           r.Pitch,
+		"o":           r.OutputFormat,
+		"style":       r.Style,
+		"styledegree": r.StyleDegree,
+		"role":        r.Role,
+		"volume":      r.Volume,
+		"lang":        r.Lang,
+		"sub":         r.Sub,
+		"bundle":      r.Bundle,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if r.Raw {
+		query.Set("raw", "true")
+	}
+	if r.MaxLine > 0 {
+		query.Set("max_line", strconv.Itoa(r.MaxLine))
+	}
+	return query
+}
+
+// CreateShareURL 处理 POST /tts/share，生成不需要 Authorization 请求头的 GET /tts 签名链接，
+// 链接以当前 key 的身份访问，key 被撤销后链接随之失效
+func CreateShareURL(c *gin.Context) {
+	var request ShareRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.Text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Text is required"})
+		return
+	}
+
+	ttl := defaultShareTTL
+	if request.ExpiresIn > 0 {
+		ttl = time.Duration(request.ExpiresIn) * time.Second
+	}
+	if ttl > maxShareTTL {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in must not exceed " + strconv.Itoa(int(maxShareTTL.Seconds())) + " seconds"})
+		return
+	}
+
+	key := requestKey(c)
+	if key == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+		return
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	query := utils.SignURL("/tts", request.query(), key.ID, expiresAt)
+
+	c.JSON(http.StatusOK, gin.H{
+		"url":        requestBaseURL(c) + "/tts?" + query.Encode(),
+		"expires_at": expiresAt.UTC().Format(time.RFC3339),
+	})
+}
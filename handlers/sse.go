@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"ms-tts-go/utils"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseChunkSize 每个 speech.audio.delta 事件包含的最大音频字节数
+const sseChunkSize = 16 * 1024
+
+// speechUsage 完成事件中的用量，按字符计算 token
+type speechUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// writeSSEEvent 写入一个 data 事件并立即刷新
+func writeSSEEvent(c *gin.Context, event interface{}) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := c.Writer.Write([]byte("data: " + string(data) + "\n\n")); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
+
+// streamSpeechEvents 以 OpenAI stream_format=sse 的格式输出音频：
+// 若干 speech.audio.delta 事件携带 base64 音频，最后一个 speech.audio.done 事件携带用量
+func streamSpeechEvents(c *gin.Context, body io.ReadCloser, input string) {
+	defer body.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	var written int64
+	buf := make([]byte, sseChunkSize)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			event := gin.H{
+				"type":  "speech.audio.delta",
+				"audio": base64.StdEncoding.EncodeToString(buf[:n]),
+			}
+			if werr := writeSSEEvent(c, event); werr != nil {
+				log.Warnf("Client disconnected while streaming events: %v", werr)
+				return
+			}
+			written += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if c.Request.Context().Err() != nil {
+				log.Warnf("Client disconnected while streaming events, sent: %s", utils.ByteCountIEC(written))
+				return
+			}
+			log.Errorf("Error reading upstream stream: %v", err)
+			e := classifyError(err)
+			writeSSEEvent(c, gin.H{
+				"type": "error",
+				"error": gin.H{
+					"message": "Failed to synthesize speech",
+					"type":    e.errType,
+					"param":   e.param,
+					"code":    e.code,
+				},
+			})
+			return
+		}
+	}
+
+	inputTokens := utf8.RuneCountInString(input)
+	writeSSEEvent(c, gin.H{
+		"type": "speech.audio.done",
+		"usage": speechUsage{
+			InputTokens:  inputTokens,
+			OutputTokens: 0,
+			TotalTokens:  inputTokens,
+		},
+	})
+	log.Infof("Voice synthesized successfully (sse). Size: %s", utils.ByteCountIEC(written))
+}
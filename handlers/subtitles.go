@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"ms-tts-go/utils"
+	"net/http"
+	"net/textproto"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 音频与字幕的打包方式
+const (
+	bundleNone      = ""
+	bundleZip       = "zip"
+	bundleMultipart = "multipart"
+)
+
+// subtitleRequest 字幕相关参数
+type subtitleRequest struct {
+	format  string
+	bundle  string
+	maxLine int
+}
+
+func (r subtitleRequest) validate() error {
+	if !utils.IsSubtitleFormat(r.format) {
+		return fmt.Errorf("subtitle format must be one of srt, vtt, json")
+	}
+	switch r.bundle {
+	case bundleNone, bundleZip, bundleMultipart:
+		return nil
+	default:
+		return fmt.Errorf("bundle must be zip or multipart")
+	}
+}
+
+// subtitleFile 生成字幕文件的内容和 Content-Type
+func subtitleFile(format string, events []utils.SynthesisEvent, maxLine int) ([]byte, string) {
+	switch format {
+	case utils.SubtitleVTT:
+		return []byte(utils.FormatWebVTT(utils.BuildSubtitleCues(events, maxLine))), "text/vtt; charset=utf-8"
+	case utils.SubtitleJSON:
+		cues := utils.BuildSubtitleCues(events, maxLine)
+		lines := make([]gin.H, 0, len(cues))
+		for _, cue := range cues {
+			lines = append(lines, gin.H{
+				"index": cue.Index,
+				"start": cue.Start.Milliseconds(),
+				"end":   cue.End.Milliseconds(),
+				"text":  cue.Text,
+			})
+		}
+		data, _ := json.Marshal(gin.H{"words": utils.WordTimings(events), "lines": lines})
+		return data, "application/json; charset=utf-8"
+	default:
+		return []byte(utils.FormatSRT(utils.BuildSubtitleCues(events, maxLine))), "application/x-subrip; charset=utf-8"
+	}
+}
+
+// writeSubtitles 合成语音并返回字幕，bundle 不为空时与音频一起打包返回
+func writeSubtitles(c *gin.Context, opts utils.SpeechOptions, sub subtitleRequest) {
+	if err := sub.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if opts.OutputFormat == "" {
+		opts.OutputFormat = "audio-24khz-48kbitrate-mono-mp3"
+	}
+	charge, err := authorizeSpeech(c, textChars(opts.Text), opts.VoiceName)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	audio, events, err := utils.SynthesizeWithMetadata(c.Request.Context(), opts)
+	if err != nil {
+		log.Errorf("Failed to synthesize voice with metadata: %v", err)
+		charge.refund()
+		writeError(c, err)
+		return
+	}
+	log.Infof("Voice synthesized with %d metadata events. Size: %s", len(events), utils.ByteCountIEC(int64(len(audio))))
+
+	subtitles, subtitleType := subtitleFile(sub.format, events, sub.maxLine)
+	audioName := "speech." + utils.FileExtension(opts.OutputFormat)
+	subtitleName := "speech." + sub.format
+	audioType := utils.ContentTypeOf(opts.OutputFormat)
+
+	switch sub.bundle {
+	case bundleZip:
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for _, file := range []struct {
+			name string
+			data []byte
+		}{{audioName, audio}, {subtitleName, subtitles}} {
+			w, err := zw.Create(file.name)
+			if err == nil {
+				_, err = w.Write(file.data)
+			}
+			if err != nil {
+				writeError(c, err)
+				return
+			}
+		}
+		if err := zw.Close(); err != nil {
+			writeError(c, err)
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="speech.zip"`)
+		c.Data(http.StatusOK, "application/zip", buf.Bytes())
+	case bundleMultipart:
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for _, part := range []struct {
+			name        string
+			contentType string
+			data        []byte
+		}{{audioName, audioType, audio}, {subtitleName, subtitleType, subtitles}} {
+			header := textproto.MIMEHeader{}
+			header.Set("Content-Type", part.contentType)
+			header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, part.name))
+			w, err := mw.CreatePart(header)
+			if err == nil {
+				_, err = w.Write(part.data)
+			}
+			if err != nil {
+				writeError(c, err)
+				return
+			}
+		}
+		mw.Close()
+		c.Data(http.StatusOK, "multipart/mixed; boundary="+mw.Boundary(), buf.Bytes())
+	default:
+		c.Data(http.StatusOK, subtitleType, subtitles)
+	}
+}
+
+// SynthesizeSubtitles 处理 /subtitles 请求，GET 使用与 /tts 相同的查询参数，POST 使用相同的 JSON
+func SynthesizeSubtitles(c *gin.Context) {
+	var opts utils.SpeechOptions
+	var sub subtitleRequest
+
+	if c.Request.Method == http.MethodPost {
+		var request SynthesizeVoiceRequest
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		opts = request.speechOptions()
+		sub = request.subtitleRequest()
+	} else {
+		opts = speechOptionsFromQuery(c)
+		sub = subtitleRequestFromQuery(c)
+	}
+
+	if opts.Text == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Text is required"})
+		return
+	}
+	if sub.format == "" {
+		sub.format = utils.SubtitleSRT
+	}
+
+	writeSubtitles(c, opts, sub)
+}
+
+// subtitleRequestFromQuery 从查询参数中读取字幕参数
+func subtitleRequestFromQuery(c *gin.Context) subtitleRequest {
+	maxLine, _ := strconv.Atoi(c.Query("max_line"))
+	return subtitleRequest{
+		format:  c.Query("sub"),
+		bundle:  c.Query("bundle"),
+		maxLine: maxLine,
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"ms-tts-go/fakeupstream"
+	"ms-tts-go/utils"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// subtitleWords 解析 sub=json 返回的单词时间
+func subtitleWords(t *testing.T, body []byte) []utils.WordTiming {
+	t.Helper()
+	var response struct {
+		Words []utils.WordTiming `json:"words"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("invalid json: %v, body: %s", err, body)
+	}
+	return response.Words
+}
+
+func TestSynthesizeSubtitles(t *testing.T) {
+	w := serve(http.MethodGet, "/subtitles?t=one+two+three.+four+five.&sub=srt", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/x-subrip") {
+		t.Errorf("Content-Type = %q", got)
+	}
+	srt := w.Body.String()
+	if !strings.HasPrefix(srt, "1\n00:00:00,000 --> ") || !strings.Contains(srt, "one two three.") {
+		t.Errorf("unexpected srt:\n%s", srt)
+	}
+
+	vtt := serve(http.MethodPost, "/subtitles", "application/json", `{"t": "one two three.", "sub": "vtt"}`)
+	if vtt.Code != http.StatusOK || !strings.HasPrefix(vtt.Body.String(), "WEBVTT") {
+		t.Errorf("vtt status = %d, body:\n%s", vtt.Code, vtt.Body.String())
+	}
+
+	words := subtitleWords(t, serve(http.MethodGet, "/subtitles?t=alpha+beta+gamma&sub=json", "", "").Body.Bytes())
+	if len(words) != 3 || words[0].Text != "alpha" || words[2].Start != 600 {
+		t.Errorf("words = %+v", words)
+	}
+}
+
+func TestSynthesizeVoiceWithSubtitleBundle(t *testing.T) {
+	w := serve(http.MethodGet, "/tts?t=bundled+subtitles+test&sub=srt", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/zip" {
+		t.Fatalf("Content-Type = %q, want application/zip", got)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	var names []string
+	for _, file := range zr.File {
+		names = append(names, file.Name)
+	}
+	if strings.Join(names, ",") != "speech.mp3,speech.srt" {
+		t.Errorf("zip contains %v", names)
+	}
+}
+
+// TestSubtitlesLongText 长文本分段合成，后续分段的时间按之前的音频时长顺延
+func TestSubtitlesLongText(t *testing.T) {
+	var text strings.Builder
+	const sentences = 200
+	for i := 0; i < sentences; i++ {
+		fmt.Fprintf(&text, "Sentence number %d is here. ", i)
+	}
+
+	before := upstream.Requests(fakeupstream.PathWebSocket)
+	body := fmt.Sprintf(`{"t": %q, "sub": "json", "o": "riff-24khz-16bit-mono-pcm"}`, text.String())
+	w := serve(http.MethodPost, "/subtitles", "application/json", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+	}
+	if chunks := upstream.Requests(fakeupstream.PathWebSocket) - before; chunks < 2 {
+		t.Fatalf("long text was synthesized in %d request", chunks)
+	}
+
+	words := subtitleWords(t, w.Body.Bytes())
+	if len(words) != sentences*5 {
+		t.Fatalf("got %d words, want %d", len(words), sentences*5)
+	}
+	step := (300 * time.Millisecond).Milliseconds()
+	for i, word := range words {
+		if word.Start != int64(i)*step {
+			t.Fatalf("word %d %q starts at %dms, want %dms", i, word.Text, word.Start, int64(i)*step)
+		}
+	}
+}
+
+func TestSubtitlesUpstreamFailures(t *testing.T) {
+	failUpstream(t, fakeupstream.PathWebSocket, http.StatusTooManyRequests)
+	w := serve(http.MethodGet, "/subtitles?t=websocket+throttled", "", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("429 handshake: status = %d, Retry-After = %q, body: %s", w.Code, w.Header().Get("Retry-After"), w.Body.String())
+	}
+
+	failUpstream(t, fakeupstream.PathWebSocket, http.StatusServiceUnavailable)
+	w = serve(http.MethodGet, "/subtitles?t=websocket+unavailable", "", "")
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "upstream unavailable") {
+		t.Errorf("503 handshake: status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	failUpstream(t, fakeupstream.PathWebSocket, http.StatusUnauthorized)
+	w = serve(http.MethodGet, "/subtitles?t=websocket+unauthorized", "", "")
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "authentication") {
+		t.Errorf("401 handshake: status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	invalid := serve(http.MethodGet, "/subtitles?t=hello&sub=ass", "", "")
+	if invalid.Code != http.StatusBadRequest {
+		t.Errorf("unknown format status = %d, want 400", invalid.Code)
+	}
+}
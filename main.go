@@ -2,7 +2,9 @@ package main
 
 import (
     "context"
+    "ms-tts-go/handlers"
     "ms-tts-go/routes"
+    "ms-tts-go/utils"
     "net/http"
     "os"
     "os/signal"
@@ -33,6 +35,10 @@ func loadConfig() {
     if os.Getenv("SECRET_TOKEN") == "" {
         log.Fatal("SECRET_TOKEN is not set. This is required.")
     }
+
+    // 包级配置依赖环境变量，必须在 .env 加载之后读取
+    utils.Init()
+    handlers.Init()
 }
 
 func main() {
@@ -41,6 +47,10 @@ func main() {
     // 配置 logger
     log.SetFormatter(&logrus.JSONFormatter{})
     log.SetLevel(logrus.InfoLevel)
+    if level, err := logrus.ParseLevel(os.Getenv("LOG_LEVEL")); err == nil {
+        log.SetLevel(level)
+        utils.SetLogLevel(level)
+    }
 
     router := routes.SetupRouter(log)
     port := os.Getenv("PORT")
@@ -65,7 +75,12 @@ func main() {
     ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
     defer cancel()
     if err := srv.Shutdown(ctx); err != nil {
-        log.Fatal("Server Shutdown:", err)
+        log.Error("Server Shutdown:", err)
+    }
+
+    // 用量是延迟写入的，退出前保存尚未写入的部分
+    if err := utils.APIKeys().Flush(); err != nil {
+        log.Errorf("failed to save api key usage: %v", err)
     }
     log.Info("Server exiting")
 }
@@ -1,15 +1,38 @@
 package middlewares
 
 import (
+    "errors"
     "github.com/gin-gonic/gin"
     "net/http"
     "strings"
     "ms-tts-go/utils"
 )
 
+// AuthMiddleware 校验 Bearer token 或签名链接，通过后将 *utils.APIKey 保存在 utils.ContextAPIKey 中
 func AuthMiddleware() gin.HandlerFunc {
     return func(c *gin.Context) {
         authHeader := c.GetHeader("Authorization")
+
+        // <audio src> 等无法设置请求头的场景使用签名链接
+        if authHeader == "" && c.Query(utils.SignedURLSignature) != "" {
+            key, err := utils.AuthenticateSignedURL(c.Request.Method, c.Request.URL.Path, c.Request.URL.Query())
+            if err != nil {
+                message := "Invalid signature"
+                if errors.Is(err, utils.ErrSignatureExpired) {
+                    message = "Signed URL expired"
+                } else if errors.Is(err, utils.ErrAPIKeyExpired) || errors.Is(err, utils.ErrAPIKeyRevoked) {
+                    message = "Token " + strings.TrimPrefix(err.Error(), "api key ")
+                }
+                c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+                c.Abort()
+                return
+            }
+
+            c.Set(utils.ContextAPIKey, key)
+            c.Next()
+            return
+        }
+
         if authHeader == "" {
             c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
             c.Abort()
@@ -23,9 +46,28 @@ func AuthMiddleware() gin.HandlerFunc {
             return
         }
 
-        token := bearerToken[1]
-        if !utils.ValidateToken(token) {
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+        key, err := utils.APIKeys().Authenticate(bearerToken[1])
+        if err != nil {
+            message := "Invalid token"
+            if errors.Is(err, utils.ErrAPIKeyExpired) || errors.Is(err, utils.ErrAPIKeyRevoked) {
+                message = "Token " + strings.TrimPrefix(err.Error(), "api key ")
+            }
+            c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+            c.Abort()
+            return
+        }
+
+        c.Set(utils.ContextAPIKey, key)
+        c.Next()
+    }
+}
+
+// RequireScope 要求当前 key 拥有指定的权限范围，需在 AuthMiddleware 之后使用
+func RequireScope(scope string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        key, ok := c.Get(utils.ContextAPIKey)
+        if !ok || !key.(*utils.APIKey).HasScope(scope) {
+            c.JSON(http.StatusForbidden, gin.H{"error": "Token does not have the " + scope + " scope"})
             c.Abort()
             return
         }
@@ -0,0 +1,47 @@
+// middlewares/ratelimit.go
+
+package middlewares
+
+import (
+    "net/http"
+    "strings"
+
+    "ms-tts-go/utils"
+
+    "github.com/gin-gonic/gin"
+)
+
+// RateLimitMiddleware 按 API key 和客户端 IP 限制每分钟的请求数，需在 AuthMiddleware 之后使用；
+// 合成的字符数由各合成接口在解析请求后计入
+func RateLimitMiddleware() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        keyID := ""
+        if value, ok := c.Get(utils.ContextAPIKey); ok {
+            keyID = value.(*utils.APIKey).ID
+        }
+
+        limit, err := utils.AllowRequest(keyID, c.ClientIP())
+        for name, value := range limit.Headers(utils.RateLimitRequests) {
+            c.Header(name, value)
+        }
+        if err != nil {
+            c.Header("Retry-After", utils.RetryAfter(err))
+            if strings.HasPrefix(c.Request.URL.Path, "/v1/") {
+                c.JSON(http.StatusTooManyRequests, gin.H{
+                    "error": gin.H{
+                        "message": err.Error(),
+                        "type":    "rate_limit_error",
+                        "param":   "",
+                        "code":    "rate_limit_exceeded",
+                    },
+                })
+            } else {
+                c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+            }
+            c.Abort()
+            return
+        }
+
+        c.Next()
+    }
+}
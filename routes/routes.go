@@ -5,6 +5,7 @@ package routes
 import (
     "ms-tts-go/handlers"
     "ms-tts-go/middlewares"
+    "ms-tts-go/utils"
 
     "github.com/gin-gonic/gin"
     "github.com/sirupsen/logrus"
@@ -13,6 +14,13 @@ import (
 func SetupRouter(log *logrus.Logger) *gin.Engine {
     router := gin.New()
 
+    // 只采用 TRUSTED_PROXIES 中的代理转发的 X-Forwarded-For，未设置时客户端 IP 即连接地址，
+    // 避免伪造请求头绕过按 IP 的限流
+    if err := router.SetTrustedProxies(utils.TrustedProxies()); err != nil {
+        log.Errorf("Invalid TRUSTED_PROXIES, using the connection address as client IP: %v", err)
+        router.SetTrustedProxies(nil)
+    }
+
     // 使用自定义的日志中间件
     router.Use(middlewares.LoggingMiddleware(log))
 
@@ -25,18 +33,33 @@ func SetupRouter(log *logrus.Logger) *gin.Engine {
     // 公开路由
     router.GET("/", handlers.Index)
 
-    // 受保护的路由
+    // 受保护的路由，每个路由要求对应的权限范围
     protected := router.Group("/")
-    protected.Use(middlewares.AuthMiddleware())
+    protected.Use(middlewares.AuthMiddleware(), middlewares.RateLimitMiddleware())
     {
-        protected.GET("/voices", handlers.GetVoiceList)
-        protected.POST("/tts", handlers.SynthesizeVoicePost)
-        protected.GET("/tts", handlers.SynthesizeVoice)
+        voices := middlewares.RequireScope(utils.ScopeVoices)
+        tts := middlewares.RequireScope(utils.ScopeTTS)
+        admin := middlewares.RequireScope(utils.ScopeAdmin)
+
+        protected.GET("/voices", voices, handlers.GetVoiceList)
+        protected.POST("/tts", tts, handlers.SynthesizeVoicePost)
+        protected.GET("/tts", tts, handlers.SynthesizeVoice)
+        protected.POST("/tts/share", tts, handlers.CreateShareURL)
+        protected.POST("/ssml", tts, handlers.SynthesizeSsml)
+        protected.GET("/subtitles", tts, handlers.SynthesizeSubtitles)
+        protected.POST("/subtitles", tts, handlers.SynthesizeSubtitles)
+        protected.GET("/config/:app", voices, handlers.ExportConfig)
+        protected.GET("/status", admin, handlers.GetStatus)
+
+        // API key 管理
+        protected.GET("/admin/keys", admin, handlers.ListKeys)
+        protected.POST("/admin/keys", admin, handlers.CreateKey)
+        protected.DELETE("/admin/keys/:id", admin, handlers.RevokeKey)
     }
 
     // 添加新的兼容 OpenAI API 的路由
     openai := router.Group("/v1")
-    openai.Use(middlewares.AuthMiddleware())
+    openai.Use(middlewares.AuthMiddleware(), middlewares.RateLimitMiddleware(), middlewares.RequireScope(utils.ScopeOpenAI))
     {
         openai.GET("/models", handlers.GetModels)
         openai.POST("/audio/speech", handlers.CreateSpeech)
@@ -0,0 +1,150 @@
+package utils
+
+import (
+    "encoding/json"
+    "os"
+    "sort"
+    "strings"
+    "unicode"
+)
+
+// VoiceAlias OpenAI 语音名称在各语言下对应的语音，default 为没有匹配语言时使用的语音
+type VoiceAlias map[string]string
+
+// defaultVoiceAliases 内置的 OpenAI 语音名称映射
+var defaultVoiceAliases = map[string]VoiceAlias{
+    "alloy":   {"default": "en-US-AvaMultilingualNeural", "en": "en-US-AvaMultilingualNeural", "zh": "zh-CN-XiaoxiaoMultilingualNeural", "ja": "ja-JP-NanamiNeural", "ko": "ko-KR-SunHiNeural"},
+    "ash":     {"default": "en-US-AndrewMultilingualNeural", "en": "en-US-DavisNeural", "zh": "zh-CN-YunjieNeural", "ja": "ja-JP-KeitaNeural", "ko": "ko-KR-InJoonNeural"},
+    "ballad":  {"default": "en-GB-RyanNeural", "en": "en-GB-RyanNeural", "zh": "zh-CN-YunfengNeural", "ja": "ja-JP-KeitaNeural", "ko": "ko-KR-InJoonNeural"},
+    "coral":   {"default": "en-US-EmmaMultilingualNeural", "en": "en-US-AriaNeural", "zh": "zh-CN-XiaomoNeural", "ja": "ja-JP-NanamiNeural", "ko": "ko-KR-SunHiNeural"},
+    "echo":    {"default": "en-US-AndrewMultilingualNeural", "en": "en-US-AndrewMultilingualNeural", "zh": "zh-CN-YunxiNeural", "ja": "ja-JP-KeitaNeural", "ko": "ko-KR-InJoonNeural"},
+    "fable":   {"default": "en-GB-RyanNeural", "en": "en-GB-RyanNeural", "zh": "zh-CN-YunjianNeural", "ja": "ja-JP-KeitaNeural", "ko": "ko-KR-InJoonNeural"},
+    "onyx":    {"default": "en-US-BrianMultilingualNeural", "en": "en-US-BrianMultilingualNeural", "zh": "zh-CN-YunyangNeural", "ja": "ja-JP-KeitaNeural", "ko": "ko-KR-InJoonNeural"},
+    "nova":    {"default": "en-US-EmmaMultilingualNeural", "en": "en-US-EmmaMultilingualNeural", "zh": "zh-CN-XiaoyiNeural", "ja": "ja-JP-NanamiNeural", "ko": "ko-KR-SunHiNeural"},
+    "sage":    {"default": "en-US-AvaMultilingualNeural", "en": "en-US-SaraNeural", "zh": "zh-CN-XiaoruiNeural", "ja": "ja-JP-NanamiNeural", "ko": "ko-KR-SunHiNeural"},
+    "shimmer": {"default": "en-US-EmmaMultilingualNeural", "en": "en-US-JennyNeural", "zh": "zh-CN-XiaohanNeural", "ja": "ja-JP-NanamiNeural", "ko": "ko-KR-SunHiNeural"},
+    "verse":   {"default": "en-US-BrianMultilingualNeural", "en": "en-US-ChristopherNeural", "zh": "zh-CN-YunzeNeural", "ja": "ja-JP-KeitaNeural", "ko": "ko-KR-InJoonNeural"},
+}
+
+// OpenAI 的 TTS 模型，hd 表示使用更高码率的输出格式
+var openAIModels = map[string]bool{
+    "tts-1":           false,
+    "tts-1-hd":        true,
+    "gpt-4o-mini-tts": true,
+}
+
+// voiceAliases 在 Init 中根据 VOICE_ALIASES_FILE 重新加载
+var voiceAliases = loadVoiceAliases("")
+
+// loadVoiceAliases 读取自定义的语音名称映射并覆盖内置映射
+func loadVoiceAliases(path string) map[string]VoiceAlias {
+    aliases := make(map[string]VoiceAlias, len(defaultVoiceAliases))
+    for name, alias := range defaultVoiceAliases {
+        aliases[name] = alias
+    }
+    if path == "" {
+        return aliases
+    }
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        log.Warnf("failed to read voice aliases file: %v", err)
+        return aliases
+    }
+    var custom map[string]VoiceAlias
+    if err := json.Unmarshal(data, &custom); err != nil {
+        log.Warnf("invalid voice aliases file %s: %v", path, err)
+        return aliases
+    }
+    for name, alias := range custom {
+        aliases[strings.ToLower(name)] = alias
+    }
+    log.Infof("loaded %d voice aliases from %s", len(custom), path)
+    return aliases
+}
+
+// VoiceAliasNames 返回所有语音别名，按名称排序
+func VoiceAliasNames() []string {
+    names := make([]string, 0, len(voiceAliases))
+    for name := range voiceAliases {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// OpenAIModelNames 返回支持的 OpenAI TTS 模型名称，按名称排序
+func OpenAIModelNames() []string {
+    names := make([]string, 0, len(openAIModels))
+    for name := range openAIModels {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// IsOpenAIModel 判断是否为 OpenAI 的 TTS 模型名称
+func IsOpenAIModel(model string) bool {
+    _, ok := openAIModels[strings.ToLower(model)]
+    return ok
+}
+
+// IsHDModel 判断模型是否应使用高码率输出
+func IsHDModel(model string) bool {
+    return openAIModels[strings.ToLower(model)]
+}
+
+// ResolveVoiceAlias 将 OpenAI 语音名称转换为语音合成服务的语音，
+// lang 为空时根据文本内容判断语言；不是别名时原样返回
+func ResolveVoiceAlias(voice, lang, text string) string {
+    alias, ok := voiceAliases[strings.ToLower(voice)]
+    if !ok {
+        return voice
+    }
+
+    if lang == "" {
+        lang = detectLanguage(text)
+    }
+    lang = strings.ToLower(lang)
+    if name := alias[lang]; name != "" {
+        return name
+    }
+    // en-US 等区域先匹配完整名称，再匹配语言部分
+    if i := strings.Index(lang, "-"); i > 0 {
+        if name := alias[lang[:i]]; name != "" {
+            return name
+        }
+    }
+    return alias["default"]
+}
+
+// detectLanguage 根据文本中的字符粗略判断语言
+func detectLanguage(text string) string {
+    var han, kana, hangul, latin int
+    for _, r := range text {
+        switch {
+        case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+            kana++
+        case unicode.Is(unicode.Hangul, r):
+            hangul++
+        case unicode.Is(unicode.Han, r):
+            han++
+        case unicode.IsLetter(r) && r < unicode.MaxLatin1:
+            latin++
+        }
+    }
+
+    switch {
+    case kana > 0:
+        return "ja"
+    case hangul > 0 && hangul >= han:
+        return "ko"
+    case han > 0 && han*4 >= latin:
+        // 一个汉字大致相当于四个英文字母
+        return "zh"
+    case latin > 0:
+        return "en"
+    default:
+        return ""
+    }
+}
@@ -0,0 +1,414 @@
+package utils
+
+import (
+    "bytes"
+    "container/list"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "io"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// maxCachedAudioSize 超过该大小的合成结果不缓存
+const maxCachedAudioSize = 32 << 20
+
+// audioCache 使用默认配置，Init 中按 AUDIO_CACHE_* 重新创建
+var audioCache = NewAudioCache(64<<20, "data/audio", 1024<<20, 7*24*time.Hour)
+
+// loadAudioCache 按 AUDIO_CACHE_* 环境变量创建音频缓存
+func loadAudioCache() *AudioCache {
+    return NewAudioCache(
+        int64(getNonNegativeInt("AUDIO_CACHE_MEMORY", 64))<<20,
+        audioCacheDir(),
+        int64(getNonNegativeInt("AUDIO_CACHE_DISK_SIZE", 1024))<<20,
+        time.Duration(getNonNegativeInt("AUDIO_CACHE_TTL", 7*24*3600))*time.Second,
+    )
+}
+
+// getNonNegativeInt 读取非负整数环境变量，0 表示关闭对应功能
+func getNonNegativeInt(name string, fallback int) int {
+    value := os.Getenv(name)
+    if value == "" {
+        return fallback
+    }
+    n, err := strconv.Atoi(value)
+    if err != nil || n < 0 {
+        log.Warnf("Invalid %s %q, using default %d", name, value, fallback)
+        return fallback
+    }
+    return n
+}
+
+// audioCacheDir 音频缓存目录，AUDIO_CACHE_DIR=off 时只使用内存缓存
+func audioCacheDir() string {
+    dir := os.Getenv("AUDIO_CACHE_DIR")
+    switch dir {
+    case "":
+        return "data/audio"
+    case "off":
+        return ""
+    default:
+        return dir
+    }
+}
+
+// AudioCacheState 用于诊断输出的音频缓存状态
+type AudioCacheState struct {
+    MemoryEntries int   `json:"memory_entries"`
+    MemoryBytes   int64 `json:"memory_bytes"`
+    DiskEntries   int   `json:"disk_entries"`
+    DiskBytes     int64 `json:"disk_bytes"`
+    Hits          int64 `json:"hits"`
+    Misses        int64 `json:"misses"`
+}
+
+// CacheStatus 一次合成请求的缓存情况
+type CacheStatus struct {
+    // Key 合成参数的哈希，相同参数总是得到相同的 Key
+    Key string
+    Hit bool
+    // StoredAt 音频生成的时间，未命中时为当前时间
+    StoredAt time.Time
+}
+
+type memoryEntry struct {
+    key      string
+    data     []byte
+    storedAt time.Time
+}
+
+type diskEntry struct {
+    size     int64
+    storedAt time.Time
+}
+
+// AudioCache 按内容寻址的合成结果缓存，内存层为按字节数限制的 LRU，
+// 磁盘层按 TTL 过期并在超过容量时删除最旧的文件
+type AudioCache struct {
+    mu sync.Mutex
+
+    memoryLimit int64
+    memorySize  int64
+    lru         *list.List
+    items       map[string]*list.Element
+
+    dir        string
+    diskLimit  int64
+    diskSize   int64
+    disk       map[string]diskEntry
+    diskLoaded bool
+
+    ttl    time.Duration
+    hits   int64
+    misses int64
+}
+
+// NewAudioCache 创建音频缓存，memoryLimit 为 0 时不使用内存层，dir 为空时不使用磁盘层，ttl 为 0 时不过期
+func NewAudioCache(memoryLimit int64, dir string, diskLimit int64, ttl time.Duration) *AudioCache {
+    return &AudioCache{
+        memoryLimit: memoryLimit,
+        lru:         list.New(),
+        items:       make(map[string]*list.Element),
+        dir:         dir,
+        diskLimit:   diskLimit,
+        disk:        make(map[string]diskEntry),
+        ttl:         ttl,
+    }
+}
+
+// enabled 判断是否至少有一层缓存可用
+func (c *AudioCache) enabled() bool {
+    return c.memoryLimit > 0 || (c.dir != "" && c.diskLimit > 0)
+}
+
+func (c *AudioCache) expired(storedAt time.Time) bool {
+    return c.ttl > 0 && time.Since(storedAt) > c.ttl
+}
+
+// Get 查找缓存的音频，先查内存再查磁盘，磁盘命中时放入内存
+func (c *AudioCache) Get(key string) ([]byte, time.Time, bool) {
+    c.mu.Lock()
+    if elem, ok := c.items[key]; ok {
+        entry := elem.Value.(*memoryEntry)
+        if !c.expired(entry.storedAt) {
+            c.lru.MoveToFront(elem)
+            c.hits++
+            c.mu.Unlock()
+            return entry.data, entry.storedAt, true
+        }
+        c.removeMemoryLocked(elem)
+    }
+
+    c.loadDiskLocked()
+    entry, ok := c.disk[key]
+    if ok && c.expired(entry.storedAt) {
+        c.removeDiskLocked(key)
+        ok = false
+    }
+    if !ok {
+        c.misses++
+        c.mu.Unlock()
+        return nil, time.Time{}, false
+    }
+    c.mu.Unlock()
+
+    data, err := os.ReadFile(c.diskPath(key))
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if err != nil {
+        // 文件可能尚未写完或已被删除，按未命中处理
+        c.misses++
+        return nil, time.Time{}, false
+    }
+    c.hits++
+    c.putMemoryLocked(key, data, entry.storedAt)
+    return data, entry.storedAt, true
+}
+
+// Put 保存音频，返回保存的时间
+func (c *AudioCache) Put(key string, data []byte) time.Time {
+    storedAt := time.Now()
+    if len(data) == 0 || !c.enabled() {
+        return storedAt
+    }
+
+    c.mu.Lock()
+    c.putMemoryLocked(key, data, storedAt)
+    if c.dir == "" || int64(len(data)) > c.diskLimit {
+        c.mu.Unlock()
+        return storedAt
+    }
+    c.loadDiskLocked()
+    if old, ok := c.disk[key]; ok {
+        c.diskSize -= old.size
+    }
+    c.disk[key] = diskEntry{size: int64(len(data)), storedAt: storedAt}
+    c.diskSize += int64(len(data))
+    evicted := c.evictDiskLocked()
+    c.mu.Unlock()
+
+    // 写磁盘不阻塞当前请求
+    go func() {
+        c.writeDisk(key, data)
+        for _, path := range evicted {
+            if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+                log.Warnf("failed to remove cached audio: %v", err)
+            }
+        }
+    }()
+    return storedAt
+}
+
+// State 返回缓存的状态
+func (c *AudioCache) State() AudioCacheState {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return AudioCacheState{
+        MemoryEntries: c.lru.Len(),
+        MemoryBytes:   c.memorySize,
+        DiskEntries:   len(c.disk),
+        DiskBytes:     c.diskSize,
+        Hits:          c.hits,
+        Misses:        c.misses,
+    }
+}
+
+func (c *AudioCache) putMemoryLocked(key string, data []byte, storedAt time.Time) {
+    if int64(len(data)) > c.memoryLimit {
+        return
+    }
+    if elem, ok := c.items[key]; ok {
+        c.removeMemoryLocked(elem)
+    }
+    c.items[key] = c.lru.PushFront(&memoryEntry{key: key, data: data, storedAt: storedAt})
+    c.memorySize += int64(len(data))
+
+    for c.memorySize > c.memoryLimit {
+        c.removeMemoryLocked(c.lru.Back())
+    }
+}
+
+func (c *AudioCache) removeMemoryLocked(elem *list.Element) {
+    entry := c.lru.Remove(elem).(*memoryEntry)
+    delete(c.items, entry.key)
+    c.memorySize -= int64(len(entry.data))
+}
+
+// diskPath 按 key 的前两位分目录，避免单个目录下文件过多
+func (c *AudioCache) diskPath(key string) string {
+    return filepath.Join(c.dir, key[:2], key)
+}
+
+// isCacheKey 判断文件名是否为 AudioCacheKey 生成的 64 位十六进制哈希
+func isCacheKey(name string) bool {
+    if len(name) != 64 {
+        return false
+    }
+    for _, r := range name {
+        if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f') {
+            return false
+        }
+    }
+    return true
+}
+
+// loadDiskLocked 首次访问时扫描缓存目录，调用方需持有锁；
+// 只索引位于对应子目录下、文件名为缓存 key 的文件，目录中的其他文件不会被淘汰删除
+func (c *AudioCache) loadDiskLocked() {
+    if c.diskLoaded || c.dir == "" {
+        return
+    }
+    c.diskLoaded = true
+
+    err := filepath.WalkDir(c.dir, func(path string, d fs.DirEntry, err error) error {
+        if err != nil || d.IsDir() || !isCacheKey(d.Name()) || path != c.diskPath(d.Name()) {
+            return nil
+        }
+        info, err := d.Info()
+        if err != nil {
+            return nil
+        }
+        c.disk[d.Name()] = diskEntry{size: info.Size(), storedAt: info.ModTime()}
+        c.diskSize += info.Size()
+        return nil
+    })
+    if err != nil && !errors.Is(err, os.ErrNotExist) {
+        log.Warnf("failed to scan audio cache directory: %v", err)
+    }
+    if len(c.disk) > 0 {
+        log.Infof("loaded %d cached audio files (%s) from %s", len(c.disk), ByteCountIEC(c.diskSize), c.dir)
+    }
+}
+
+// removeDiskLocked 从索引中移除并在后台删除文件，调用方需持有锁
+func (c *AudioCache) removeDiskLocked(key string) {
+    entry, ok := c.disk[key]
+    if !ok {
+        return
+    }
+    delete(c.disk, key)
+    c.diskSize -= entry.size
+    path := c.diskPath(key)
+    go os.Remove(path)
+}
+
+// evictDiskLocked 删除过期的文件，仍超过容量时从最旧的开始删除，返回需要删除的文件
+func (c *AudioCache) evictDiskLocked() []string {
+    if c.diskSize <= c.diskLimit {
+        return nil
+    }
+
+    keys := make([]string, 0, len(c.disk))
+    for key := range c.disk {
+        keys = append(keys, key)
+    }
+    sort.Slice(keys, func(i, j int) bool {
+        return c.disk[keys[i]].storedAt.Before(c.disk[keys[j]].storedAt)
+    })
+
+    var evicted []string
+    for _, key := range keys {
+        entry := c.disk[key]
+        if c.diskSize <= c.diskLimit && !c.expired(entry.storedAt) {
+            break
+        }
+        delete(c.disk, key)
+        c.diskSize -= entry.size
+        evicted = append(evicted, c.diskPath(key))
+    }
+    return evicted
+}
+
+// writeDisk 先写临时文件再重命名，避免读到写了一半的文件
+func (c *AudioCache) writeDisk(key string, data []byte) {
+    path := c.diskPath(key)
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+        log.Warnf("failed to create audio cache directory: %v", err)
+        return
+    }
+    tmp := path + ".tmp"
+    if err := os.WriteFile(tmp, data, 0o644); err != nil {
+        log.Warnf("failed to write cached audio: %v", err)
+        return
+    }
+    if err := os.Rename(tmp, path); err != nil {
+        log.Warnf("failed to replace cached audio: %v", err)
+    }
+}
+
+// AudioCacheKey 计算合成参数的缓存键，文本去掉首尾空白并合并连续的空白
+func AudioCacheKey(opts SpeechOptions) string {
+    opts.applyDefaults()
+    text := strings.Join(strings.Fields(opts.Text), " ")
+
+    h := sha256.New()
+    for _, field := range []string{
+        text, opts.VoiceName, opts.Rate, opts.Pitch, opts.Style, opts.StyleDegree,
+        opts.Role, opts.Volume, opts.Lang, strconv.FormatBool(opts.RawSSML), opts.OutputFormat,
+    } {
+        h.Write([]byte(field))
+        h.Write([]byte{0})
+    }
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachingReader 在读取合成结果的同时缓存，完整读到 EOF 后才写入缓存
+type cachingReader struct {
+    io.ReadCloser
+    key      string
+    buf      bytes.Buffer
+    overflow bool
+    stored   bool
+}
+
+func (r *cachingReader) Read(p []byte) (int, error) {
+    n, err := r.ReadCloser.Read(p)
+    if n > 0 && !r.overflow {
+        if r.buf.Len()+n > maxCachedAudioSize {
+            r.overflow = true
+            r.buf = bytes.Buffer{}
+        } else {
+            r.buf.Write(p[:n])
+        }
+    }
+    if err == io.EOF && !r.overflow && !r.stored {
+        r.stored = true
+        audioCache.Put(r.key, r.buf.Bytes())
+    }
+    return n, err
+}
+
+// SynthesizeCached 与 SynthesizeStream 相同，但相同参数的结果会从缓存中返回
+func SynthesizeCached(ctx context.Context, opts SpeechOptions) (io.ReadCloser, CacheStatus, error) {
+    status := CacheStatus{Key: AudioCacheKey(opts), StoredAt: time.Now()}
+    if !audioCache.enabled() {
+        body, err := SynthesizeStream(ctx, opts)
+        return body, status, err
+    }
+
+    if data, storedAt, ok := audioCache.Get(status.Key); ok {
+        status.Hit = true
+        status.StoredAt = storedAt
+        return io.NopCloser(bytes.NewReader(data)), status, nil
+    }
+
+    body, err := SynthesizeStream(ctx, opts)
+    if err != nil {
+        return nil, status, err
+    }
+    return &cachingReader{ReadCloser: body, key: status.Key}, status, nil
+}
+
+// GetAudioCacheState 返回音频缓存的诊断信息
+func GetAudioCacheState() AudioCacheState {
+    return audioCache.State()
+}
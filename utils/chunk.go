@@ -0,0 +1,158 @@
+package utils
+
+import (
+    "os"
+    "strconv"
+    "strings"
+    "unicode"
+)
+
+// 长文本分段配置，可通过环境变量覆盖
+var (
+    maxChunkChars    = 1500
+    chunkConcurrency = 3
+)
+
+// loadChunkConfig 从环境变量读取长文本分段配置
+func loadChunkConfig() {
+    maxChunkChars = getPositiveInt("MAX_CHUNK_CHARS", 1500)
+    chunkConcurrency = getPositiveInt("CHUNK_CONCURRENCY", 3)
+}
+
+func getPositiveInt(name string, fallback int) int {
+    value := os.Getenv(name)
+    if value == "" {
+        return fallback
+    }
+    n, err := strconv.Atoi(value)
+    if err != nil || n <= 0 {
+        log.Warnf("Invalid %s %q, using default %d", name, value, fallback)
+        return fallback
+    }
+    return n
+}
+
+// 句末标点，分段时优先在其后断开
+var sentenceEnds = map[rune]bool{
+    '。': true, '！': true, '？': true, '；': true, '…': true,
+    '.': true, '!': true, '?': true, ';': true,
+}
+
+// 句内停顿标点，句子过长时在其后断开
+var clauseEnds = map[rune]bool{
+    '，': true, '、': true, '：': true,
+    ',': true, ':': true,
+}
+
+// 紧跟在句末标点后的收尾字符，不应与句子分开
+var closingMarks = map[rune]bool{
+    '"': true, '\'': true, ')': true, ']': true,
+    '”': true, '’': true, '）': true, '】': true, '」': true, '』': true, '》': true,
+}
+
+// SplitText 按段落和句子将文本拆分为不超过 maxChars 个字符的片段
+func SplitText(text string, maxChars int) []string {
+    if maxChars <= 0 {
+        maxChars = maxChunkChars
+    }
+    if len([]rune(text)) <= maxChars {
+        return []string{text}
+    }
+
+    var chunks []string
+    var current []rune
+
+    flush := func() {
+        if strings.TrimSpace(string(current)) != "" {
+            chunks = append(chunks, strings.TrimSpace(string(current)))
+        }
+        current = current[:0]
+    }
+
+    // 多个短段落可以合并到同一片段，段落之间用换行分隔
+    for _, paragraph := range strings.Split(text, "\n") {
+        if strings.TrimSpace(paragraph) == "" {
+            continue
+        }
+        for i, sentence := range splitSentences([]rune(paragraph), maxChars) {
+            if len(current)+len(sentence)+1 > maxChars {
+                flush()
+            }
+            if i == 0 && len(current) > 0 {
+                current = append(current, '\n')
+            }
+            current = append(current, sentence...)
+        }
+    }
+    flush()
+
+    return chunks
+}
+
+// splitSentences 将段落拆分为句子，超长句子继续在逗号处或按长度截断
+func splitSentences(paragraph []rune, maxChars int) [][]rune {
+    var sentences [][]rune
+    for _, sentence := range splitAfter(paragraph, sentenceEnds) {
+        if len(sentence) <= maxChars {
+            sentences = append(sentences, sentence)
+            continue
+        }
+        var current []rune
+        for _, clause := range splitAfter(sentence, clauseEnds) {
+            for len(clause) > maxChars {
+                cut := hardCut(clause, maxChars)
+                if len(current) > 0 {
+                    sentences = append(sentences, current)
+                    current = nil
+                }
+                sentences = append(sentences, clause[:cut])
+                clause = clause[cut:]
+            }
+            if len(current)+len(clause) > maxChars {
+                sentences = append(sentences, current)
+                current = nil
+            }
+            current = append(current, clause...)
+        }
+        if len(current) > 0 {
+            sentences = append(sentences, current)
+        }
+    }
+    return sentences
+}
+
+// splitAfter 在指定标点 (及其后的收尾字符) 之后断开
+func splitAfter(text []rune, marks map[rune]bool) [][]rune {
+    var parts [][]rune
+    start := 0
+    for i := 0; i < len(text); i++ {
+        if !marks[text[i]] {
+            continue
+        }
+        end := i + 1
+        for end < len(text) && (marks[text[end]] || closingMarks[text[end]]) {
+            end++
+        }
+        // 英文句点后必须是空白或结尾，避免拆开 3.14、e.g. 等
+        if text[i] == '.' && end < len(text) && !unicode.IsSpace(text[end]) {
+            continue
+        }
+        parts = append(parts, text[start:end])
+        start = end
+        i = end - 1
+    }
+    if start < len(text) {
+        parts = append(parts, text[start:])
+    }
+    return parts
+}
+
+// hardCut 找到不超过 maxChars 的截断位置，优先在空白处
+func hardCut(text []rune, maxChars int) int {
+    for i := maxChars; i > maxChars/2; i-- {
+        if unicode.IsSpace(text[i-1]) {
+            return i
+        }
+    }
+    return maxChars
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+    "unicode"
+)
+
+func TestSplitText(t *testing.T) {
+    tests := []struct {
+        name     string
+        text     string
+        maxChars int
+        want     []string
+    }{
+        {"short text", "Hello world.", 100, []string{"Hello world."}},
+        {"english sentences", "First sentence. Second sentence. Third sentence.", 20,
+            []string{"First sentence.", "Second sentence.", "Third sentence."}},
+        {"chinese sentences", "第一句。第二句！第三句？", 8,
+            []string{"第一句。", "第二句！", "第三句？"}},
+        {"sentences merged up to the limit", "第一句。第二句！第三句？", 9,
+            []string{"第一句。第二句！", "第三句？"}},
+        {"decimal point is not a sentence end", "Pi is 3.14 today. Next.", 18,
+            []string{"Pi is 3.14 today.", "Next."}},
+        {"closing quote stays with its sentence", `He said "stop." Then left.`, 16,
+            []string{`He said "stop."`, "Then left."}},
+        {"long sentence split at commas", "alpha, beta, gamma, delta", 14,
+            []string{"alpha, beta,", "gamma, delta"}},
+        {"hard cut at whitespace", "aaaa bbbb cccc dddd", 10,
+            []string{"aaaa bbbb", "cccc dddd"}},
+        {"hard cut counts runes, not bytes", strings.Repeat("字", 25), 10,
+            []string{strings.Repeat("字", 10), strings.Repeat("字", 10), strings.Repeat("字", 5)}},
+        {"short paragraphs share a chunk", "Short one.\nShort two.\nA much longer third paragraph here.", 25,
+            []string{"Short one.\nShort two.", "A much longer third", "paragraph here."}},
+        {"blank paragraphs are dropped", "First part.\n\n\nSecond part here.", 17,
+            []string{"First part.", "Second part here."}},
+        {"default limit", strings.Repeat("a", 1500), 0, []string{strings.Repeat("a", 1500)}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := SplitText(tt.text, tt.maxChars)
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Fatalf("SplitText = %q, want %q", got, tt.want)
+            }
+            limit := tt.maxChars
+            if limit <= 0 {
+                limit = maxChunkChars
+            }
+            for _, chunk := range got {
+                if n := len([]rune(chunk)); n > limit {
+                    t.Errorf("chunk %q has %d characters, limit %d", chunk, n, limit)
+                }
+            }
+            if withoutSpace(strings.Join(got, "")) != withoutSpace(tt.text) {
+                t.Errorf("chunks do not cover the original text: %q", got)
+            }
+        })
+    }
+}
+
+// withoutSpace 去掉所有空白，分段只会丢弃片段首尾的空白
+func withoutSpace(s string) string {
+    return strings.Map(func(r rune) rune {
+        if unicode.IsSpace(r) {
+            return -1
+        }
+        return r
+    }, s)
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+    "context"
+    "errors"
+    "net"
+    "net/http"
+    "os"
+    "strconv"
+    "time"
+)
+
+// 上游请求的超时配置，单位为秒，可通过环境变量覆盖
+var (
+    connectTimeout = 10 * time.Second
+    readTimeout    = 30 * time.Second
+    requestTimeout = 120 * time.Second
+)
+
+// loadClientConfig 从环境变量读取超时配置并重新创建 HTTP 客户端
+func loadClientConfig() {
+    connectTimeout = getTimeout("CONNECT_TIMEOUT", 10*time.Second)
+    readTimeout = getTimeout("READ_TIMEOUT", 30*time.Second)
+    requestTimeout = getTimeout("REQUEST_TIMEOUT", 120*time.Second)
+    client = newHTTPClient()
+}
+
+func getTimeout(name string, fallback time.Duration) time.Duration {
+    value := os.Getenv(name)
+    if value == "" {
+        return fallback
+    }
+    seconds, err := strconv.ParseFloat(value, 64)
+    if err != nil || seconds <= 0 {
+        log.Warnf("Invalid %s %q, using default %s", name, value, fallback)
+        return fallback
+    }
+    return time.Duration(seconds * float64(time.Second))
+}
+
+// newHTTPClient 创建带有连接、读取和总超时的 HTTP 客户端
+func newHTTPClient() *http.Client {
+    dialer := &net.Dialer{
+        Timeout:   connectTimeout,
+        KeepAlive: 30 * time.Second,
+    }
+    transport := &http.Transport{
+        Proxy:                 http.ProxyFromEnvironment,
+        DialContext:           dialer.DialContext,
+        TLSHandshakeTimeout:   connectTimeout,
+        ResponseHeaderTimeout: readTimeout,
+        IdleConnTimeout:       90 * time.Second,
+        MaxIdleConnsPerHost:   16,
+        ForceAttemptHTTP2:     true,
+    }
+    return &http.Client{
+        Transport: transport,
+        Timeout:   requestTimeout,
+    }
+}
+
+// IsTimeout 判断错误是否由上游超时引起
+func IsTimeout(err error) bool {
+    if err == nil {
+        return false
+    }
+    if errors.Is(err, context.DeadlineExceeded) {
+        return true
+    }
+    var netErr net.Error
+    return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// IsCanceled 判断错误是否由调用方取消引起
+func IsCanceled(err error) bool {
+    return errors.Is(err, context.Canceled)
+}
+
+// sleepContext 等待指定时间，ctx 结束时提前返回
+func sleepContext(ctx context.Context, d time.Duration) error {
+    timer := time.NewTimer(d)
+    defer timer.Stop()
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-timer.C:
+        return nil
+    }
+}
@@ -0,0 +1,371 @@
+package utils
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// audioContainer 输出格式对应的容器类型
+type audioContainer int
+
+const (
+    containerUnknown audioContainer = iota
+    containerMP3
+    containerRaw
+    containerWAV
+    containerOgg
+    containerAMR
+)
+
+var amrWBHeader = []byte("#!AMR-WB\n")
+
+// amrWBFrameSizes AMR-WB 各帧类型的数据长度 (不含 1 字节帧头)，-1 为保留类型
+var amrWBFrameSizes = [16]int{17, 23, 32, 36, 40, 46, 50, 58, 60, 5, -1, -1, -1, -1, 0, 0}
+
+var (
+    bitratePattern    = regexp.MustCompile(`(\d+)kbitrate`)
+    sampleRatePattern = regexp.MustCompile(`(\d+)(k?)hz`)
+)
+
+func containerOf(outputFormat string) audioContainer {
+    switch {
+    case strings.HasPrefix(outputFormat, "riff-"):
+        return containerWAV
+    case strings.HasPrefix(outputFormat, "ogg-"):
+        return containerOgg
+    case strings.HasPrefix(outputFormat, "raw-"):
+        return containerRaw
+    case strings.HasPrefix(outputFormat, "amr-"):
+        return containerAMR
+    case strings.HasSuffix(outputFormat, "-mp3"):
+        return containerMP3
+    default:
+        return containerUnknown
+    }
+}
+
+// CanConcatAudio 判断输出格式是否支持分段合成后拼接
+func CanConcatAudio(outputFormat string) bool {
+    return containerOf(outputFormat) != containerUnknown
+}
+
+// isAppendable 判断格式能否逐段直接追加输出，无需改写头部
+func isAppendable(outputFormat string) bool {
+    switch containerOf(outputFormat) {
+    case containerMP3, containerRaw, containerAMR:
+        return true
+    default:
+        return false
+    }
+}
+
+// continuationPart 去掉后续分段中重复的文件头，使其可以直接追加在前一段之后
+func continuationPart(outputFormat string, part []byte) []byte {
+    switch containerOf(outputFormat) {
+    case containerMP3:
+        return stripID3v2(part)
+    case containerAMR:
+        return bytes.TrimPrefix(part, amrWBHeader)
+    default:
+        return part
+    }
+}
+
+// ConcatAudio 按输出格式拼接多段音频
+func ConcatAudio(outputFormat string, parts [][]byte) ([]byte, error) {
+    if len(parts) == 1 {
+        return parts[0], nil
+    }
+
+    switch containerOf(outputFormat) {
+    case containerMP3, containerRaw, containerAMR:
+        var buf bytes.Buffer
+        for i, part := range parts {
+            if i > 0 {
+                part = continuationPart(outputFormat, part)
+            }
+            buf.Write(part)
+        }
+        return buf.Bytes(), nil
+    case containerWAV:
+        return concatWAV(parts)
+    case containerOgg:
+        return concatOgg(parts)
+    default:
+        return nil, fmt.Errorf("%w: %s cannot be concatenated", ErrUnsupportedFormat, outputFormat)
+    }
+}
+
+// stripID3v2 去掉 MP3 开头的 ID3v2 标签
+func stripID3v2(data []byte) []byte {
+    if len(data) < 10 || string(data[:3]) != "ID3" {
+        return data
+    }
+    size := int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 | int(data[8]&0x7f)<<7 | int(data[9]&0x7f)
+    end := 10 + size
+    if data[5]&0x10 != 0 {
+        end += 10 // footer
+    }
+    if end > len(data) {
+        return data
+    }
+    return data[end:]
+}
+
+// splitWAV 返回 WAV 文件 data 块之前的头部和 PCM 数据
+func splitWAV(data []byte) ([]byte, []byte, error) {
+    if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+        return nil, nil, errors.New("invalid wav data")
+    }
+    pos := 12
+    for pos+8 <= len(data) {
+        id := string(data[pos : pos+4])
+        size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+        body := pos + 8
+        if id == "data" {
+            end := body + size
+            // 流式输出时 data 块长度可能未填写
+            if size == 0 || end > len(data) || end < body {
+                end = len(data)
+            }
+            return data[:body], data[body:end], nil
+        }
+        pos = body + size + size%2
+    }
+    return nil, nil, errors.New("wav data chunk not found")
+}
+
+// concatWAV 合并多个 WAV 文件的 PCM 数据并重写 RIFF 与 data 块长度
+func concatWAV(parts [][]byte) ([]byte, error) {
+    header, _, err := splitWAV(parts[0])
+    if err != nil {
+        return nil, err
+    }
+
+    var pcm bytes.Buffer
+    for _, part := range parts {
+        _, data, err := splitWAV(part)
+        if err != nil {
+            return nil, err
+        }
+        pcm.Write(data)
+    }
+
+    out := make([]byte, 0, len(header)+pcm.Len())
+    out = append(out, header...)
+    out = append(out, pcm.Bytes()...)
+    binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+    binary.LittleEndian.PutUint32(out[len(header)-4:len(header)], uint32(pcm.Len()))
+    return out, nil
+}
+
+// oggPage Ogg 页的头部字段及原始数据
+type oggPage struct {
+    headerType byte
+    granule    int64
+    serial     uint32
+    sequence   uint32
+    raw        []byte
+}
+
+func parseOggPages(data []byte) ([]oggPage, error) {
+    var pages []oggPage
+    for pos := 0; pos < len(data); {
+        if pos+27 > len(data) || string(data[pos:pos+4]) != "OggS" {
+            return nil, errors.New("invalid ogg page")
+        }
+        segments := int(data[pos+26])
+        if pos+27+segments > len(data) {
+            return nil, errors.New("truncated ogg page")
+        }
+        size := 27 + segments
+        for _, lacing := range data[pos+27 : pos+27+segments] {
+            size += int(lacing)
+        }
+        if pos+size > len(data) {
+            return nil, errors.New("truncated ogg page")
+        }
+        raw := data[pos : pos+size]
+        pages = append(pages, oggPage{
+            headerType: raw[5],
+            granule:    int64(binary.LittleEndian.Uint64(raw[6:14])),
+            serial:     binary.LittleEndian.Uint32(raw[14:18]),
+            sequence:   binary.LittleEndian.Uint32(raw[18:22]),
+            raw:        raw,
+        })
+        pos += size
+    }
+    return pages, nil
+}
+
+// payload 返回页的数据部分
+func (p oggPage) payload() []byte {
+    return p.raw[27+int(p.raw[26]):]
+}
+
+// opusPreSkip 返回 OpusHead 中的 pre-skip (解码器预热的样本数)，没有 OpusHead 时返回 0
+func opusPreSkip(pages []oggPage) int64 {
+    for _, page := range pages {
+        payload := page.payload()
+        if len(payload) >= 12 && string(payload[:8]) == "OpusHead" {
+            return int64(binary.LittleEndian.Uint16(payload[10:12]))
+        }
+    }
+    return 0
+}
+
+// concatOgg 将多个 Ogg Opus 流合并为一个逻辑流：
+// 丢弃后续流的头部页，重写序列号、页序号和 granule 位置并重新计算校验和。
+// 合并后只有第一段的 OpusHead，后续流的 granule 需扣除各自的 pre-skip 才能与实际播放时长对齐
+func concatOgg(parts [][]byte) ([]byte, error) {
+    var out bytes.Buffer
+    var serial, sequence uint32
+    var granuleOffset, lastGranule int64
+
+    for i, part := range parts {
+        pages, err := parseOggPages(part)
+        if err != nil {
+            return nil, err
+        }
+        if i == 0 && len(pages) > 0 {
+            serial = pages[0].serial
+        }
+        var preSkip int64
+        if i > 0 {
+            preSkip = opusPreSkip(pages)
+        }
+
+        for j, page := range pages {
+            // OpusHead、OpusTags 所在页的 granule 为 0，只保留第一段的
+            if i > 0 && page.granule == 0 {
+                continue
+            }
+
+            raw := append([]byte(nil), page.raw...)
+            headerType := page.headerType
+            if i > 0 {
+                headerType &^= 0x02 // BOS
+            }
+            if i < len(parts)-1 || j < len(pages)-1 {
+                headerType &^= 0x04 // EOS
+            }
+            granule := page.granule
+            if granule != -1 {
+                granule = granuleOffset + max(granule-preSkip, 0)
+                lastGranule = granule
+            }
+
+            raw[5] = headerType
+            binary.LittleEndian.PutUint64(raw[6:14], uint64(granule))
+            binary.LittleEndian.PutUint32(raw[14:18], serial)
+            binary.LittleEndian.PutUint32(raw[18:22], sequence)
+            binary.LittleEndian.PutUint32(raw[22:26], 0)
+            binary.LittleEndian.PutUint32(raw[22:26], oggCRC(raw))
+            sequence++
+
+            out.Write(raw)
+        }
+        granuleOffset = lastGranule
+    }
+    return out.Bytes(), nil
+}
+
+// audioDuration 计算一段音频的播放时长，格式无法计算时使用最后一个事件的结束时间
+func audioDuration(outputFormat string, data []byte, events []SynthesisEvent) time.Duration {
+    var duration time.Duration
+    switch containerOf(outputFormat) {
+    case containerMP3:
+        if m := bitratePattern.FindStringSubmatch(outputFormat); m != nil {
+            kbps, _ := strconv.Atoi(m[1])
+            duration = time.Duration(len(stripID3v2(data))) * 8 * time.Millisecond / time.Duration(kbps)
+        }
+    case containerRaw:
+        duration = pcmDuration(outputFormat, data)
+    case containerWAV:
+        if _, pcm, err := splitWAV(data); err == nil {
+            duration = pcmDuration(outputFormat, pcm)
+        }
+    case containerOgg:
+        if pages, err := parseOggPages(data); err == nil && len(pages) > 0 {
+            // Opus 的 granule 固定以 48kHz 计
+            samples := pages[len(pages)-1].granule - opusPreSkip(pages)
+            duration = time.Duration(samples) * time.Second / 48000
+        }
+    case containerAMR:
+        duration = amrWBDuration(data)
+    }
+    if duration > 0 {
+        return duration
+    }
+
+    for _, event := range events {
+        if end := event.Offset + event.Duration; end > duration {
+            duration = end
+        }
+    }
+    return duration
+}
+
+// pcmDuration 根据格式中的采样率和位深计算 PCM、A-law、μ-law 数据的时长
+func pcmDuration(outputFormat string, pcm []byte) time.Duration {
+    if strings.HasSuffix(outputFormat, "-truesilk") {
+        return 0
+    }
+    m := sampleRatePattern.FindStringSubmatch(outputFormat)
+    if m == nil {
+        return 0
+    }
+    sampleRate, _ := strconv.Atoi(m[1])
+    if m[2] == "k" {
+        sampleRate *= 1000
+    }
+    bytesPerSample := 2
+    if strings.Contains(outputFormat, "-8bit-") {
+        bytesPerSample = 1
+    }
+    return time.Duration(len(pcm)/bytesPerSample) * time.Second / time.Duration(sampleRate)
+}
+
+// amrWBDuration 按帧数计算 AMR-WB 的时长，每帧 20 毫秒
+func amrWBDuration(data []byte) time.Duration {
+    data = bytes.TrimPrefix(data, amrWBHeader)
+    frames := 0
+    for pos := 0; pos < len(data); frames++ {
+        size := amrWBFrameSizes[data[pos]>>3&0x0f]
+        if size < 0 {
+            break
+        }
+        pos += 1 + size
+    }
+    return time.Duration(frames) * 20 * time.Millisecond
+}
+
+var oggCRCTable = func() [256]uint32 {
+    var table [256]uint32
+    for i := range table {
+        r := uint32(i) << 24
+        for j := 0; j < 8; j++ {
+            if r&0x80000000 != 0 {
+                r = r<<1 ^ 0x04c11db7
+            } else {
+                r <<= 1
+            }
+        }
+        table[i] = r
+    }
+    return table
+}()
+
+func oggCRC(data []byte) uint32 {
+    var crc uint32
+    for _, b := range data {
+        crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+    }
+    return crc
+}
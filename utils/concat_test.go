@@ -0,0 +1,328 @@
+package utils
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "testing"
+    "time"
+)
+
+const (
+    testMP3Format = "audio-24khz-48kbitrate-mono-mp3"
+    testWAVFormat = "riff-24khz-16bit-mono-pcm"
+    testOggFormat = "ogg-24khz-16bit-mono-opus"
+)
+
+// oggTestPage 构造只有一个段的 Ogg 页，payload 不超过 255 字节
+func oggTestPage(headerType byte, granule int64, serial, sequence uint32, payload []byte) []byte {
+    page := make([]byte, 27, 28+len(payload))
+    copy(page, "OggS")
+    page[5] = headerType
+    binary.LittleEndian.PutUint64(page[6:14], uint64(granule))
+    binary.LittleEndian.PutUint32(page[14:18], serial)
+    binary.LittleEndian.PutUint32(page[18:22], sequence)
+    page[26] = 1
+    page = append(page, byte(len(payload)))
+    page = append(page, payload...)
+    binary.LittleEndian.PutUint32(page[22:26], oggCRC(page))
+    return page
+}
+
+// opusTestStream 构造 OpusHead、OpusTags 加两个音频页的 Ogg Opus 流，每个音频页 960 个样本 (20 毫秒)
+func opusTestStream(serial uint32, preSkip uint16, audio string) []byte {
+    head := []byte("OpusHead\x01\x01")
+    head = binary.LittleEndian.AppendUint16(head, preSkip)
+    head = binary.LittleEndian.AppendUint32(head, 24000)
+    head = append(head, 0, 0, 0)
+
+    var stream []byte
+    stream = append(stream, oggTestPage(0x02, 0, serial, 0, head)...)
+    stream = append(stream, oggTestPage(0, 0, serial, 1, []byte("OpusTags"))...)
+    stream = append(stream, oggTestPage(0, int64(preSkip)+960, serial, 2, []byte(audio+"1"))...)
+    stream = append(stream, oggTestPage(0x04, int64(preSkip)+1920, serial, 3, []byte(audio+"2"))...)
+    return stream
+}
+
+// wavTestFile 构造 24kHz 16 位单声道 WAV，list 为 true 时在 data 块前加入 LIST 块，
+// dataSize 为 data 块头中填写的长度，流式输出时为 0
+func wavTestFile(pcm []byte, list bool, dataSize uint32) []byte {
+    var buf bytes.Buffer
+    buf.WriteString("RIFF\x00\x00\x00\x00WAVE")
+    buf.WriteString("fmt ")
+    binary.Write(&buf, binary.LittleEndian, uint32(16))
+    binary.Write(&buf, binary.LittleEndian, []uint16{1, 1})
+    binary.Write(&buf, binary.LittleEndian, []uint32{24000, 48000})
+    binary.Write(&buf, binary.LittleEndian, []uint16{2, 16})
+    if list {
+        buf.WriteString("LIST")
+        binary.Write(&buf, binary.LittleEndian, uint32(5))
+        buf.WriteString("INFOx\x00")
+    }
+    buf.WriteString("data")
+    binary.Write(&buf, binary.LittleEndian, dataSize)
+    buf.Write(pcm)
+
+    data := buf.Bytes()
+    binary.LittleEndian.PutUint32(data[4:8], uint32(len(data)-8))
+    return data
+}
+
+// id3TestTag 构造正文为 size 字节的 ID3v2.4 标签，footer 为 true 时带有 10 字节的尾部
+func id3TestTag(size int, footer bool) []byte {
+    tag := []byte{'I', 'D', '3', 4, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+    if footer {
+        tag[5] = 0x10
+    }
+    tag = append(tag, make([]byte, size)...)
+    if footer {
+        tag = append(tag, '3', 'D', 'I', 4, 0, 0x10, 0, 0, 0, 0)
+    }
+    return tag
+}
+
+func concatBytes(parts ...[]byte) []byte {
+    return bytes.Join(parts, nil)
+}
+
+func TestOggCRC(t *testing.T) {
+    // CRC-32，多项式 0x04c11db7，初始值和结果异或均为 0
+    if got := oggCRC([]byte("123456789")); got != 0x89a1897f {
+        t.Errorf("oggCRC = %#x, want 0x89a1897f", got)
+    }
+}
+
+func TestConcatOgg(t *testing.T) {
+    tests := []struct {
+        name     string
+        preSkips []uint16
+    }{
+        {"two streams without pre-skip", []uint16{0, 0}},
+        {"three streams with pre-skip", []uint16{312, 312, 312}},
+        {"different pre-skips", []uint16{312, 0, 120}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var parts [][]byte
+            var wantPayloads []string
+            for i, preSkip := range tt.preSkips {
+                audio := string(rune('a' + i))
+                parts = append(parts, opusTestStream(uint32(1000+i), preSkip, audio))
+                wantPayloads = append(wantPayloads, audio+"1", audio+"2")
+            }
+
+            out, err := ConcatAudio(testOggFormat, parts)
+            if err != nil {
+                t.Fatalf("ConcatAudio = %v", err)
+            }
+            pages, err := parseOggPages(out)
+            if err != nil {
+                t.Fatalf("output is not a valid ogg stream: %v", err)
+            }
+            if want := 2 + 2*len(parts); len(pages) != want {
+                t.Fatalf("got %d pages, want %d", len(pages), want)
+            }
+
+            // 只保留第一段的头部页，之后的 granule 扣除各自的 pre-skip 后接在前一段之后
+            first := int64(tt.preSkips[0])
+            wantGranules := []int64{0, 0}
+            for i := range wantPayloads {
+                wantGranules = append(wantGranules, first+960*int64(i+1))
+            }
+
+            for i, page := range pages {
+                if page.serial != 1000 {
+                    t.Errorf("page %d serial = %d, want 1000", i, page.serial)
+                }
+                if page.sequence != uint32(i) {
+                    t.Errorf("page %d sequence = %d, want %d", i, page.sequence, i)
+                }
+                if page.granule != wantGranules[i] {
+                    t.Errorf("page %d granule = %d, want %d", i, page.granule, wantGranules[i])
+                }
+                if bos := page.headerType&0x02 != 0; bos != (i == 0) {
+                    t.Errorf("page %d BOS = %v", i, bos)
+                }
+                if eos := page.headerType&0x04 != 0; eos != (i == len(pages)-1) {
+                    t.Errorf("page %d EOS = %v", i, eos)
+                }
+
+                raw := append([]byte(nil), page.raw...)
+                binary.LittleEndian.PutUint32(raw[22:26], 0)
+                if crc := binary.LittleEndian.Uint32(page.raw[22:26]); crc != oggCRC(raw) {
+                    t.Errorf("page %d crc = %#x, want %#x", i, crc, oggCRC(raw))
+                }
+                if i >= 2 && string(page.payload()) != wantPayloads[i-2] {
+                    t.Errorf("page %d payload = %q, want %q", i, page.payload(), wantPayloads[i-2])
+                }
+            }
+
+            if got, want := audioDuration(testOggFormat, out, nil), time.Duration(len(parts))*40*time.Millisecond; got != want {
+                t.Errorf("audioDuration = %s, want %s", got, want)
+            }
+        })
+    }
+}
+
+func TestConcatOggRejectsInvalidData(t *testing.T) {
+    stream := opusTestStream(1, 312, "a")
+    for name, part := range map[string][]byte{
+        "not ogg":   []byte("RIFF0000WAVE"),
+        "truncated": stream[:len(stream)-1],
+    } {
+        if _, err := ConcatAudio(testOggFormat, [][]byte{stream, part}); err == nil {
+            t.Errorf("%s: ConcatAudio succeeded", name)
+        }
+    }
+}
+
+func TestConcatWAV(t *testing.T) {
+    tests := []struct {
+        name  string
+        parts [][]byte
+        pcm   []byte
+    }{
+        {
+            "two files",
+            [][]byte{wavTestFile([]byte("0123"), false, 4), wavTestFile([]byte("4567"), false, 4)},
+            []byte("01234567"),
+        },
+        {
+            "three files with a LIST chunk",
+            [][]byte{wavTestFile([]byte("0123"), true, 4), wavTestFile([]byte("45"), false, 2), wavTestFile([]byte("6789"), true, 4)},
+            []byte("0123456789"),
+        },
+        {
+            "streamed data chunk without size",
+            [][]byte{wavTestFile([]byte("0123"), false, 0), wavTestFile([]byte("4567"), false, 0), wavTestFile([]byte("89"), false, 2)},
+            []byte("0123456789"),
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            out, err := ConcatAudio(testWAVFormat, tt.parts)
+            if err != nil {
+                t.Fatalf("ConcatAudio = %v", err)
+            }
+
+            firstHeader, _, _ := splitWAV(tt.parts[0])
+            header, pcm, err := splitWAV(out)
+            if err != nil {
+                t.Fatalf("output is not a valid wav file: %v", err)
+            }
+            if len(header) != len(firstHeader) || !bytes.Equal(header[8:len(header)-4], firstHeader[8:len(firstHeader)-4]) {
+                t.Errorf("header changed:\n got %q\nwant %q", header, firstHeader)
+            }
+            if size := binary.LittleEndian.Uint32(out[4:8]); int(size) != len(out)-8 {
+                t.Errorf("RIFF size = %d, want %d", size, len(out)-8)
+            }
+            if size := binary.LittleEndian.Uint32(header[len(header)-4:]); int(size) != len(tt.pcm) {
+                t.Errorf("data size = %d, want %d", size, len(tt.pcm))
+            }
+            if !bytes.Equal(pcm, tt.pcm) {
+                t.Errorf("pcm = %q, want %q", pcm, tt.pcm)
+            }
+            if got, want := audioDuration(testWAVFormat, out, nil), time.Duration(len(tt.pcm)/2)*time.Second/24000; got != want {
+                t.Errorf("audioDuration = %s, want %s", got, want)
+            }
+        })
+    }
+
+    if _, err := ConcatAudio(testWAVFormat, [][]byte{wavTestFile([]byte("01"), false, 2), []byte("not a wav file")}); err == nil {
+        t.Error("ConcatAudio accepted an invalid wav part")
+    }
+}
+
+func TestStripID3v2(t *testing.T) {
+    frames := []byte("\xff\xfbframes")
+    tests := []struct {
+        name string
+        data []byte
+        want []byte
+    }{
+        {"no tag", frames, frames},
+        {"tag", concatBytes(id3TestTag(20, false), frames), frames},
+        {"tag with footer", concatBytes(id3TestTag(20, true), frames), frames},
+        {"large synchsafe size", concatBytes(id3TestTag(300, false), frames), frames},
+        {"truncated tag is kept", id3TestTag(20, false)[:15], id3TestTag(20, false)[:15]},
+        {"too short", []byte("ID3"), []byte("ID3")},
+    }
+    for _, tt := range tests {
+        if got := stripID3v2(tt.data); !bytes.Equal(got, tt.want) {
+            t.Errorf("%s: stripID3v2 = %q, want %q", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestConcatAppendable(t *testing.T) {
+    tag := id3TestTag(20, false)
+    tests := []struct {
+        name   string
+        format string
+        parts  [][]byte
+        want   []byte
+    }{
+        {
+            "mp3 keeps only the first ID3 tag",
+            testMP3Format,
+            [][]byte{concatBytes(tag, []byte("one")), concatBytes(id3TestTag(8, true), []byte("two")), []byte("three")},
+            concatBytes(tag, []byte("onetwothree")),
+        },
+        {
+            "amr-wb keeps only the first header",
+            "amr-wb-16000hz",
+            [][]byte{concatBytes(amrWBHeader, []byte("one")), concatBytes(amrWBHeader, []byte("two"))},
+            concatBytes(amrWBHeader, []byte("onetwo")),
+        },
+        {
+            "raw pcm is appended as-is",
+            "raw-24khz-16bit-mono-pcm",
+            [][]byte{[]byte("0123"), []byte("4567"), []byte("89")},
+            []byte("0123456789"),
+        },
+        {
+            "single part is returned unchanged",
+            testMP3Format,
+            [][]byte{concatBytes(tag, []byte("one"))},
+            concatBytes(tag, []byte("one")),
+        },
+    }
+    for _, tt := range tests {
+        got, err := ConcatAudio(tt.format, tt.parts)
+        if err != nil {
+            t.Errorf("%s: ConcatAudio = %v", tt.name, err)
+            continue
+        }
+        if !bytes.Equal(got, tt.want) {
+            t.Errorf("%s: ConcatAudio = %q, want %q", tt.name, got, tt.want)
+        }
+    }
+
+    if _, err := ConcatAudio("webm-24khz-16bit-mono-opus", [][]byte{{1}, {2}}); !errors.Is(err, ErrUnsupportedFormat) {
+        t.Errorf("webm: ConcatAudio = %v, want ErrUnsupportedFormat", err)
+    }
+}
+
+func TestAudioDuration(t *testing.T) {
+    tests := []struct {
+        name   string
+        format string
+        data   []byte
+        events []SynthesisEvent
+        want   time.Duration
+    }{
+        {"mp3 by bitrate", testMP3Format, concatBytes(id3TestTag(20, false), make([]byte, 6000)), nil, time.Second},
+        {"raw pcm", "raw-24khz-16bit-mono-pcm", make([]byte, 24000), nil, 500 * time.Millisecond},
+        {"8 bit mu-law", "raw-8khz-8bit-mono-mulaw", make([]byte, 8000), nil, time.Second},
+        {"amr-wb frames", "amr-wb-16000hz", concatBytes(amrWBHeader, bytes.Repeat(append([]byte{0x44}, make([]byte, 60)...), 5)), nil, 100 * time.Millisecond},
+        {"falls back to the last event", "webm-24khz-16bit-mono-opus", []byte{1, 2, 3},
+            []SynthesisEvent{{Offset: time.Second, Duration: 200 * time.Millisecond}, {Offset: 500 * time.Millisecond}}, 1200 * time.Millisecond},
+    }
+    for _, tt := range tests {
+        if got := audioDuration(tt.format, tt.data, tt.events); got != tt.want {
+            t.Errorf("%s: audioDuration = %s, want %s", tt.name, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+)
+
+// 上游错误的分类，可通过 errors.Is 判断
+var (
+    ErrUpstreamAuth        = errors.New("upstream authentication failed")
+    ErrUpstreamThrottled   = errors.New("upstream throttled the request")
+    ErrInvalidSSML         = errors.New("upstream rejected the ssml")
+    ErrUnsupportedFormat   = errors.New("unsupported output format")
+    ErrUpstreamUnavailable = errors.New("upstream unavailable")
+)
+
+// UpstreamError 描述上游返回的非 2xx 响应
+type UpstreamError struct {
+    Kind       error
+    StatusCode int
+    Message    string
+    RetryAfter string
+}
+
+func (e *UpstreamError) Error() string {
+    if e.Message == "" {
+        return fmt.Sprintf("%v (status %d)", e.Kind, e.StatusCode)
+    }
+    return fmt.Sprintf("%v (status %d): %s", e.Kind, e.StatusCode, e.Message)
+}
+
+func (e *UpstreamError) Unwrap() error {
+    return e.Kind
+}
+
+// checkResponse 检查上游响应状态码，失败时读取错误信息并关闭响应体
+func checkResponse(resp *http.Response) error {
+    if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+        return nil
+    }
+    defer resp.Body.Close()
+
+    message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+    upstreamErr := &UpstreamError{
+        StatusCode: resp.StatusCode,
+        Message:    strings.TrimSpace(string(message)),
+        RetryAfter: resp.Header.Get("Retry-After"),
+    }
+
+    switch resp.StatusCode {
+    case http.StatusUnauthorized, http.StatusForbidden:
+        upstreamErr.Kind = ErrUpstreamAuth
+    case http.StatusTooManyRequests:
+        upstreamErr.Kind = ErrUpstreamThrottled
+    case http.StatusBadRequest:
+        upstreamErr.Kind = ErrInvalidSSML
+    case http.StatusUnsupportedMediaType:
+        upstreamErr.Kind = ErrUnsupportedFormat
+    default:
+        upstreamErr.Kind = ErrUpstreamUnavailable
+    }
+
+    log.Warnf("upstream returned error: %v", upstreamErr)
+    return upstreamErr
+}
+
+// RetryAfter 返回上游或限流建议的重试时间 (秒)，没有时返回空字符串
+func RetryAfter(err error) string {
+    var upstreamErr *UpstreamError
+    if errors.As(err, &upstreamErr) {
+        return upstreamErr.RetryAfter
+    }
+    var rateLimitErr *RateLimitError
+    if errors.As(err, &rateLimitErr) {
+        return retryAfterSeconds(rateLimitErr.RetryAfter)
+    }
+    return ""
+}
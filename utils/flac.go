@@ -0,0 +1,192 @@
+package utils
+
+import (
+    "bytes"
+    "encoding/binary"
+    "io"
+)
+
+// flacBlockSize 每个 FLAC 帧包含的采样数
+const flacBlockSize = 4096
+
+// flacSampleRateCodes 帧头中可直接编码的采样率
+var flacSampleRateCodes = map[int]byte{
+    8000:  0x4,
+    16000: 0x5,
+    22050: 0x6,
+    24000: 0x7,
+    32000: 0x8,
+    44100: 0x9,
+    48000: 0xA,
+}
+
+// WrapAudioStream 将上游音频封装为目标容器，wrap 为空时原样返回
+func WrapAudioStream(body io.ReadCloser, wrap string, sampleRate int) io.ReadCloser {
+    switch wrap {
+    case "flac":
+        return NewFLACStream(body, sampleRate)
+    default:
+        return body
+    }
+}
+
+// flacStream 边读取 16 位单声道 PCM 边输出 FLAC 数据
+type flacStream struct {
+    *io.PipeReader
+    source io.ReadCloser
+}
+
+func (s *flacStream) Close() error {
+    s.source.Close()
+    return s.PipeReader.Close()
+}
+
+// NewFLACStream 将 16 位小端单声道 PCM 流封装为 FLAC，使用不压缩的 verbatim 子帧
+func NewFLACStream(pcm io.ReadCloser, sampleRate int) io.ReadCloser {
+    pr, pw := io.Pipe()
+
+    go func() {
+        defer pcm.Close()
+
+        if _, err := pw.Write(flacStreamHeader(sampleRate)); err != nil {
+            return
+        }
+
+        buf := make([]byte, flacBlockSize*2)
+        var frameNumber uint64
+        for {
+            n, err := io.ReadFull(pcm, buf)
+            // 丢弃不完整的最后一个采样
+            n -= n % 2
+            if n > 0 {
+                if _, werr := pw.Write(flacFrame(buf[:n], frameNumber, sampleRate)); werr != nil {
+                    return
+                }
+                frameNumber++
+            }
+            if err == io.EOF || err == io.ErrUnexpectedEOF {
+                pw.Close()
+                return
+            }
+            if err != nil {
+                pw.CloseWithError(err)
+                return
+            }
+        }
+    }()
+
+    return &flacStream{PipeReader: pr, source: pcm}
+}
+
+// flacStreamHeader 生成 fLaC 标记和 STREAMINFO 元数据块，总采样数未知时填 0
+func flacStreamHeader(sampleRate int) []byte {
+    var b bytes.Buffer
+    b.WriteString("fLaC")
+    // 最后一个元数据块，类型 0 (STREAMINFO)，长度 34
+    b.Write([]byte{0x80, 0x00, 0x00, 34})
+
+    info := make([]byte, 34)
+    binary.BigEndian.PutUint16(info[0:2], 16)
+    binary.BigEndian.PutUint16(info[2:4], flacBlockSize)
+    // 最小、最大帧长度未知，保留为 0
+    // 采样率 20 位，声道数-1 3 位，位深-1 5 位，总采样数 36 位
+    packed := uint64(sampleRate)<<44 | uint64(0)<<41 | uint64(15)<<36
+    binary.BigEndian.PutUint64(info[10:18], packed)
+    // MD5 未计算，保留为 0
+    b.Write(info)
+    return b.Bytes()
+}
+
+// flacFrame 将一块 PCM 编码为一个 FLAC 帧
+func flacFrame(pcm []byte, frameNumber uint64, sampleRate int) []byte {
+    samples := len(pcm) / 2
+
+    var frame bytes.Buffer
+    frame.Write([]byte{0xFF, 0xF8})
+
+    rateCode, ok := flacSampleRateCodes[sampleRate]
+    if !ok {
+        // 帧头中无法编码的采样率从 STREAMINFO 读取
+        rateCode = 0x0
+    }
+    blockCode := byte(0x7) // 块大小以 16 位形式写在帧头末尾
+    if samples == flacBlockSize {
+        blockCode = 0xC
+    }
+    frame.WriteByte(blockCode<<4 | rateCode)
+    // 单声道，16 位
+    frame.WriteByte(0x00<<4 | 0x4<<1)
+    frame.Write(flacUTF8(frameNumber))
+    if blockCode == 0x7 {
+        frame.Write([]byte{byte((samples - 1) >> 8), byte(samples - 1)})
+    }
+    frame.WriteByte(flacCRC8(frame.Bytes()))
+
+    // verbatim 子帧，采样以大端有符号整数存储
+    frame.WriteByte(0x02)
+    for i := 0; i < samples; i++ {
+        frame.WriteByte(pcm[i*2+1])
+        frame.WriteByte(pcm[i*2])
+    }
+
+    crc := flacCRC16(frame.Bytes())
+    frame.Write([]byte{byte(crc >> 8), byte(crc)})
+    return frame.Bytes()
+}
+
+// flacUTF8 按 FLAC 规范以类 UTF-8 方式编码帧号
+func flacUTF8(v uint64) []byte {
+    if v < 0x80 {
+        return []byte{byte(v)}
+    }
+    var n int
+    switch {
+    case v < 0x800:
+        n = 2
+    case v < 0x10000:
+        n = 3
+    case v < 0x200000:
+        n = 4
+    case v < 0x4000000:
+        n = 5
+    default:
+        n = 6
+    }
+    out := make([]byte, n)
+    for i := n - 1; i > 0; i-- {
+        out[i] = 0x80 | byte(v&0x3F)
+        v >>= 6
+    }
+    out[0] = byte(0xFF<<(8-n)) | byte(v)
+    return out
+}
+
+func flacCRC8(data []byte) byte {
+    var crc byte
+    for _, b := range data {
+        crc ^= b
+        for i := 0; i < 8; i++ {
+            if crc&0x80 != 0 {
+                crc = crc<<1 ^ 0x07
+            } else {
+                crc <<= 1
+            }
+        }
+    }
+    return crc
+}
+
+func flacCRC16(data []byte) uint16 {
+    var crc uint16
+    for _, b := range data {
+        crc ^= uint16(b) << 8
+        for i := 0; i < 8; i++ {
+            if crc&0x8000 != 0 {
+                crc = crc<<1 ^ 0x8005
+            } else {
+                crc <<= 1
+            }
+        }
+    }
+    return crc
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+    "fmt"
+    "strings"
+)
+
+// outputFormats 语音合成服务支持的 X-Microsoft-OutputFormat 取值
+var outputFormats = map[string]bool{
+    "amr-wb-16000hz":                     true,
+    "audio-16khz-16bit-32kbps-mono-opus": true,
+    "audio-16khz-32kbitrate-mono-mp3":    true,
+    "audio-16khz-64kbitrate-mono-mp3":    true,
+    "audio-16khz-128kbitrate-mono-mp3":   true,
+    "audio-24khz-16bit-24kbps-mono-opus": true,
+    "audio-24khz-16bit-48kbps-mono-opus": true,
+    "audio-24khz-48kbitrate-mono-mp3":    true,
+    "audio-24khz-96kbitrate-mono-mp3":    true,
+    "audio-24khz-160kbitrate-mono-mp3":   true,
+    "audio-48khz-96kbitrate-mono-mp3":    true,
+    "audio-48khz-192kbitrate-mono-mp3":   true,
+    "ogg-16khz-16bit-mono-opus":          true,
+    "ogg-24khz-16bit-mono-opus":          true,
+    "ogg-48khz-16bit-mono-opus":          true,
+    "raw-8khz-8bit-mono-alaw":            true,
+    "raw-8khz-8bit-mono-mulaw":           true,
+    "raw-8khz-16bit-mono-pcm":            true,
+    "raw-16khz-16bit-mono-pcm":           true,
+    "raw-16khz-16bit-mono-truesilk":      true,
+    "raw-22050hz-16bit-mono-pcm":         true,
+    "raw-24khz-16bit-mono-pcm":           true,
+    "raw-24khz-16bit-mono-truesilk":      true,
+    "raw-44100hz-16bit-mono-pcm":         true,
+    "raw-48khz-16bit-mono-pcm":           true,
+    "riff-8khz-8bit-mono-alaw":           true,
+    "riff-8khz-8bit-mono-mulaw":          true,
+    "riff-8khz-16bit-mono-pcm":           true,
+    "riff-16khz-16bit-mono-pcm":          true,
+    "riff-22050hz-16bit-mono-pcm":        true,
+    "riff-24khz-16bit-mono-pcm":          true,
+    "riff-44100hz-16bit-mono-pcm":        true,
+    "riff-48khz-16bit-mono-pcm":          true,
+    "webm-16khz-16bit-mono-opus":         true,
+    "webm-24khz-16bit-24kbps-mono-opus":  true,
+    "webm-24khz-16bit-mono-opus":         true,
+}
+
+// IsSupportedOutputFormat 判断输出格式是否被语音合成服务支持
+func IsSupportedOutputFormat(format string) bool {
+    return outputFormats[format]
+}
+
+// DefaultOutputFormat 返回未指定输出格式时使用的格式
+func DefaultOutputFormat() string {
+    return defaultOutputFormat
+}
+
+// OpenAIFormat OpenAI response_format 对应的合成参数
+type OpenAIFormat struct {
+    // OutputFormat 请求上游时使用的 X-Microsoft-OutputFormat
+    OutputFormat string
+    // ContentType 返回给客户端的 Content-Type
+    ContentType string
+    // Wrap 上游没有对应格式时，在本地封装的容器，如 flac
+    Wrap string
+    // SampleRate 上游音频的采样率，本地封装时使用
+    SampleRate int
+}
+
+// openAIFormats OpenAI response_format 到语音合成服务输出格式的映射
+var openAIFormats = map[string]OpenAIFormat{
+    "mp3":  {OutputFormat: "audio-24khz-48kbitrate-mono-mp3", ContentType: "audio/mpeg"},
+    "opus": {OutputFormat: "ogg-24khz-16bit-mono-opus", ContentType: "audio/opus"},
+    // 上游不支持 FLAC，获取 PCM 后在本地封装
+    "flac": {OutputFormat: "raw-24khz-16bit-mono-pcm", ContentType: "audio/flac", Wrap: "flac", SampleRate: 24000},
+    "wav":  {OutputFormat: "riff-24khz-16bit-mono-pcm", ContentType: "audio/wav"},
+    "pcm":  {OutputFormat: "raw-24khz-16bit-mono-pcm", ContentType: "audio/pcm"},
+}
+
+// openAIHDFormats tts-1-hd 等高质量模型使用的输出格式，pcm 按 OpenAI 约定固定为 24kHz
+var openAIHDFormats = map[string]OpenAIFormat{
+    "mp3":  {OutputFormat: "audio-48khz-192kbitrate-mono-mp3", ContentType: "audio/mpeg"},
+    "opus": {OutputFormat: "ogg-48khz-16bit-mono-opus", ContentType: "audio/opus"},
+    "flac": {OutputFormat: "raw-48khz-16bit-mono-pcm", ContentType: "audio/flac", Wrap: "flac", SampleRate: 48000},
+    "wav":  {OutputFormat: "riff-48khz-16bit-mono-pcm", ContentType: "audio/wav"},
+    "pcm":  {OutputFormat: "raw-24khz-16bit-mono-pcm", ContentType: "audio/pcm"},
+}
+
+// ResolveOpenAIFormat 将 OpenAI 的 response_format 转换为合成参数，hd 为 true 时使用高码率格式，
+// 也接受语音合成服务的原始格式名称，为空时使用 mp3
+func ResolveOpenAIFormat(name string, hd bool) (OpenAIFormat, error) {
+    if name == "" {
+        name = "mp3"
+    }
+    formats := openAIFormats
+    if hd {
+        formats = openAIHDFormats
+    }
+    if format, ok := formats[strings.ToLower(name)]; ok {
+        return format, nil
+    }
+    // 上游不支持 AAC，也不在本地转码，直接拒绝而不是返回其他编码的音频
+    if strings.EqualFold(name, "aac") {
+        return OpenAIFormat{}, fmt.Errorf("%w: aac is not available, use mp3 or opus instead", ErrUnsupportedFormat)
+    }
+    if IsSupportedOutputFormat(name) {
+        return OpenAIFormat{OutputFormat: name, ContentType: ContentTypeOf(name)}, nil
+    }
+    return OpenAIFormat{}, fmt.Errorf("%w: %s, supported: mp3, opus, flac, wav, pcm", ErrUnsupportedFormat, name)
+}
+
+// ContentTypeOf 返回语音合成服务输出格式对应的 Content-Type
+func ContentTypeOf(outputFormat string) string {
+    switch {
+    case strings.HasSuffix(outputFormat, "-mp3"):
+        return "audio/mpeg"
+    case strings.HasPrefix(outputFormat, "riff-"):
+        return "audio/wav"
+    case strings.HasPrefix(outputFormat, "ogg-"):
+        return "audio/ogg"
+    case strings.HasPrefix(outputFormat, "webm-"):
+        return "audio/webm"
+    case strings.HasPrefix(outputFormat, "amr-"):
+        return "audio/amr-wb"
+    case strings.HasPrefix(outputFormat, "raw-"):
+        return "audio/pcm"
+    default:
+        return "application/octet-stream"
+    }
+}
+
+// FileExtension 返回输出格式对应的文件扩展名
+func FileExtension(outputFormat string) string {
+    switch {
+    case strings.HasSuffix(outputFormat, "-mp3"):
+        return "mp3"
+    case strings.HasPrefix(outputFormat, "riff-"):
+        return "wav"
+    case strings.HasPrefix(outputFormat, "ogg-"):
+        return "ogg"
+    case strings.HasPrefix(outputFormat, "webm-"):
+        return "webm"
+    case strings.HasPrefix(outputFormat, "amr-"):
+        return "amr"
+    case strings.HasPrefix(outputFormat, "raw-"):
+        return "pcm"
+    default:
+        return "bin"
+    }
+}
@@ -0,0 +1,197 @@
+package utils
+
+import (
+    "context"
+    "encoding/json"
+    "os"
+    "strconv"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+// InstructionRule 将 instructions 中的关键词映射为说话风格和韵律调整，
+// 英文等关键词按整词匹配，中日韩关键词按子串匹配
+type InstructionRule struct {
+    Keywords []string `json:"keywords"`
+    // Style 说话风格，所选语音不支持时忽略
+    Style string `json:"style,omitempty"`
+    // StyleDegree 风格强度，0 表示不调整
+    StyleDegree float64 `json:"styledegree,omitempty"`
+    // Rate、Pitch 为相对当前值的百分比增量
+    Rate  float64 `json:"rate,omitempty"`
+    Pitch float64 `json:"pitch,omitempty"`
+    // Volume 为 0-100 的绝对音量，0 表示不调整
+    Volume float64 `json:"volume,omitempty"`
+}
+
+// defaultInstructionRules 内置规则，风格按出现顺序尝试，第一个被语音支持的生效
+var defaultInstructionRules = []InstructionRule{
+    {Keywords: []string{"cheerful", "happy", "joyful", "upbeat", "开心", "高兴", "欢快", "愉快"}, Style: "cheerful"},
+    {Keywords: []string{"excited", "enthusiastic", "energetic", "激动", "兴奋"}, Style: "excited", Rate: 10},
+    {Keywords: []string{"sad", "melancholy", "sorrowful", "悲伤", "难过", "伤心"}, Style: "sad", Rate: -10},
+    {Keywords: []string{"angry", "furious", "生气", "愤怒"}, Style: "angry"},
+    {Keywords: []string{"whisper", "whispering", "耳语", "低语", "悄悄"}, Style: "whispering", Volume: 30},
+    {Keywords: []string{"shout", "shouting", "yell", "喊", "大声"}, Style: "shouting", Volume: 90},
+    {Keywords: []string{"scared", "terrified", "fearful", "害怕", "恐惧"}, Style: "terrified"},
+    {Keywords: []string{"friendly", "warm", "友好", "亲切", "温暖"}, Style: "friendly"},
+    {Keywords: []string{"gentle", "soft-spoken", "温柔", "柔和"}, Style: "gentle"},
+    {Keywords: []string{"calm", "soothing", "relaxed", "平静", "舒缓"}, Style: "calm", Rate: -5},
+    {Keywords: []string{"serious", "formal", "严肃", "正式"}, Style: "serious"},
+    {Keywords: []string{"hopeful", "optimistic", "充满希望"}, Style: "hopeful"},
+    {Keywords: []string{"empathetic", "compassionate", "sympathetic", "同情", "共情"}, Style: "empathetic"},
+    {Keywords: []string{"newscast", "news anchor", "broadcast", "新闻", "播音"}, Style: "newscast"},
+    {Keywords: []string{"storytelling", "storyteller", "narrate", "narrator", "narrating", "narration", "讲故事", "旁白"}, Style: "narration-professional"},
+    {Keywords: []string{"very", "extremely", "really", "非常", "特别", "极其"}, StyleDegree: 1.6},
+    {Keywords: []string{"slightly", "a bit", "a little", "subtle", "稍微", "有点", "略微"}, StyleDegree: 0.6},
+    {Keywords: []string{"slow", "slowly", "缓慢", "语速慢", "放慢"}, Rate: -20},
+    {Keywords: []string{"fast", "quickly", "rapid", "快速", "语速快", "加快"}, Rate: 20},
+    {Keywords: []string{"high-pitched", "higher pitch", "高音", "尖细"}, Pitch: 10},
+    {Keywords: []string{"deep", "low-pitched", "lower pitch", "低沉", "浑厚"}, Pitch: -10},
+    {Keywords: []string{"loud", "loudly", "响亮"}, Volume: 80},
+    {Keywords: []string{"quiet", "quietly", "softly", "小声", "轻声"}, Volume: 30},
+}
+
+// instructionRules 在 Init 中根据 INSTRUCTION_RULES_FILE 重新加载
+var instructionRules = defaultInstructionRules
+
+// loadInstructionRules 读取自定义规则，文件中的规则会替换内置规则
+func loadInstructionRules(path string) []InstructionRule {
+    if path == "" {
+        return defaultInstructionRules
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        log.Warnf("failed to read instruction rules file: %v", err)
+        return defaultInstructionRules
+    }
+    var rules []InstructionRule
+    if err := json.Unmarshal(data, &rules); err != nil {
+        log.Warnf("invalid instruction rules file %s: %v", path, err)
+        return defaultInstructionRules
+    }
+    log.Infof("loaded %d instruction rules from %s", len(rules), path)
+    return rules
+}
+
+// ApplyInstructions 根据 instructions 调整合成参数，调用方已显式指定的风格和音量不会被覆盖，
+// 语速和语调在现有值上叠加
+func ApplyInstructions(ctx context.Context, opts SpeechOptions, instructions string) SpeechOptions {
+    instructions = strings.ToLower(strings.TrimSpace(instructions))
+    if instructions == "" {
+        return opts
+    }
+
+    var styles []string
+    var styleDegree, rate, pitch, volume float64
+    for _, rule := range instructionRules {
+        if !rule.matches(instructions) {
+            continue
+        }
+        if rule.Style != "" {
+            styles = append(styles, rule.Style)
+        }
+        if rule.StyleDegree != 0 && styleDegree == 0 {
+            styleDegree = rule.StyleDegree
+        }
+        if rule.Volume != 0 && volume == 0 {
+            volume = rule.Volume
+        }
+        rate += rule.Rate
+        pitch += rule.Pitch
+    }
+
+    if opts.Style == "" && len(styles) > 0 {
+        opts.Style = supportedStyle(ctx, opts.VoiceName, styles)
+    }
+    if opts.StyleDegree == "" && styleDegree != 0 && opts.Style != "" {
+        opts.StyleDegree = formatNumber(styleDegree)
+    }
+    if opts.Volume == "" && volume != 0 {
+        opts.Volume = formatNumber(volume)
+    }
+    if rate != 0 {
+        opts.Rate = addPercent(opts.Rate, rate, -100, 200)
+    }
+    if pitch != 0 {
+        opts.Pitch = addPercent(opts.Pitch, pitch, -50, 50)
+    }
+
+    log.Debugf("Instructions %q mapped to style: %s, styledegree: %s, rate: %s, pitch: %s, volume: %s",
+        instructions, opts.Style, opts.StyleDegree, opts.Rate, opts.Pitch, opts.Volume)
+    return opts
+}
+
+func (r InstructionRule) matches(instructions string) bool {
+    for _, keyword := range r.Keywords {
+        if keyword != "" && containsKeyword(instructions, strings.ToLower(keyword)) {
+            return true
+        }
+    }
+    return false
+}
+
+// containsKeyword 判断 text 是否包含 keyword，含中日韩字符的关键词按子串匹配，
+// 其他关键词要求前后不是字母或数字，避免 "fast" 匹配到 "breakfast"
+func containsKeyword(text, keyword string) bool {
+    if strings.IndexFunc(keyword, isCJK) >= 0 {
+        return strings.Contains(text, keyword)
+    }
+    for start := 0; ; {
+        i := strings.Index(text[start:], keyword)
+        if i < 0 {
+            return false
+        }
+        i += start
+        end := i + len(keyword)
+        before, _ := utf8.DecodeLastRuneInString(text[:i])
+        after, _ := utf8.DecodeRuneInString(text[end:])
+        if (i == 0 || !isWordRune(before)) && (end == len(text) || !isWordRune(after)) {
+            return true
+        }
+        start = i + 1
+    }
+}
+
+func isWordRune(r rune) bool {
+    return (unicode.IsLetter(r) || unicode.IsDigit(r)) && !isCJK(r)
+}
+
+// supportedStyle 返回第一个被语音支持的风格，语音列表不可用时不设置风格
+func supportedStyle(ctx context.Context, voiceName string, styles []string) string {
+    if voiceName == "" {
+        voiceName = DefaultVoiceName()
+    }
+    voices, err := VoiceListContext(ctx)
+    if err != nil {
+        log.Warnf("Ignoring instruction styles, voice list unavailable: %v", err)
+        return ""
+    }
+    voice, ok := FindVoice(voices, voiceName)
+    if !ok {
+        return ""
+    }
+    for _, style := range styles {
+        if voice.SupportsStyle(style) {
+            return style
+        }
+    }
+    log.Debugf("Voice %s supports none of the instruction styles %v", voiceName, styles)
+    return ""
+}
+
+// addPercent 在百分比参数上叠加增量并限制范围
+func addPercent(value string, delta, min, max float64) string {
+    current, _ := strconv.ParseFloat(value, 64)
+    result := current + delta
+    if result < min {
+        result = min
+    } else if result > max {
+        result = max
+    }
+    return formatNumber(result)
+}
+
+func formatNumber(value float64) string {
+    return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,431 @@
+package utils
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+)
+
+// API key 的权限范围
+const (
+    ScopeVoices = "voices"
+    ScopeTTS    = "tts"
+    ScopeOpenAI = "openai"
+    ScopeAdmin  = "admin"
+)
+
+// AllScopes 全部权限范围
+var AllScopes = []string{ScopeVoices, ScopeTTS, ScopeOpenAI, ScopeAdmin}
+
+// ContextAPIKey 认证通过后 *APIKey 在 gin.Context 中的键
+const ContextAPIKey = "apiKey"
+
+// legacyKeyID 使用 SECRET_TOKEN 认证时的 key id
+const legacyKeyID = "default"
+
+// keyUsageFlushDelay 用量变化后延迟写入文件，避免每个请求都写磁盘
+const keyUsageFlushDelay = 10 * time.Second
+
+var (
+    ErrInvalidAPIKey   = errors.New("invalid api key")
+    ErrAPIKeyExpired   = errors.New("api key expired")
+    ErrAPIKeyRevoked   = errors.New("api key revoked")
+    ErrAPIKeyNotFound  = errors.New("api key not found")
+    ErrQuotaExceeded   = errors.New("daily character quota exceeded")
+    ErrVoiceNotAllowed = errors.New("voice not allowed for this api key")
+)
+
+// APIKey 一个 API key，只保存密钥的 SHA-256
+type APIKey struct {
+    ID            string     `json:"id"`
+    Label         string     `json:"label"`
+    Hash          string     `json:"hash"`
+    Prefix        string     `json:"prefix"`
+    Scopes        []string   `json:"scopes"`
+    ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+    RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+    CreatedAt     time.Time  `json:"created_at"`
+    DailyChars    int        `json:"daily_chars,omitempty"`
+    AllowedVoices []string   `json:"allowed_voices,omitempty"`
+    // 当天 (UTC) 已合成的字符数
+    UsageDay   string `json:"usage_day,omitempty"`
+    UsageChars int    `json:"usage_chars,omitempty"`
+}
+
+// APIKeyInfo 管理接口返回的 key 信息，不包含哈希
+type APIKeyInfo struct {
+    ID            string     `json:"id"`
+    Label         string     `json:"label"`
+    Prefix        string     `json:"prefix"`
+    Scopes        []string   `json:"scopes"`
+    ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+    RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+    CreatedAt     time.Time  `json:"created_at"`
+    DailyChars    int        `json:"daily_chars"`
+    AllowedVoices []string   `json:"allowed_voices,omitempty"`
+    UsedToday     int        `json:"used_today"`
+}
+
+// NewAPIKey 创建 key 的参数
+type NewAPIKey struct {
+    Label         string
+    Scopes        []string
+    ExpiresAt     *time.Time
+    DailyChars    int
+    AllowedVoices []string
+}
+
+// HasScope 判断 key 是否拥有指定的权限范围，admin 拥有全部权限
+func (k *APIKey) HasScope(scope string) bool {
+    for _, s := range k.Scopes {
+        if s == scope || s == ScopeAdmin {
+            return true
+        }
+    }
+    return false
+}
+
+// AllowsVoice 判断 key 是否可以使用指定的语音，未限制时可以使用全部语音
+func (k *APIKey) AllowsVoice(voice string) bool {
+    if len(k.AllowedVoices) == 0 {
+        return true
+    }
+    return containsFold(k.AllowedVoices, voice)
+}
+
+func (k *APIKey) usedToday() int {
+    if k.UsageDay != usageDay() {
+        return 0
+    }
+    return k.UsageChars
+}
+
+// Info 返回不含哈希的 key 信息
+func (k *APIKey) Info() APIKeyInfo {
+    return APIKeyInfo{
+        ID:            k.ID,
+        Label:         k.Label,
+        Prefix:        k.Prefix,
+        Scopes:        k.Scopes,
+        ExpiresAt:     k.ExpiresAt,
+        RevokedAt:     k.RevokedAt,
+        CreatedAt:     k.CreatedAt,
+        DailyChars:    k.DailyChars,
+        AllowedVoices: k.AllowedVoices,
+        UsedToday:     k.usedToday(),
+    }
+}
+
+// legacyKey SECRET_TOKEN 对应的 key，拥有全部权限且不限配额
+func legacyKey() *APIKey {
+    return &APIKey{ID: legacyKeyID, Label: "SECRET_TOKEN", Scopes: AllScopes}
+}
+
+func usageDay() string {
+    return time.Now().UTC().Format("2006-01-02")
+}
+
+// KeyStore 保存在 JSON 文件中的 API key，SECRET_TOKEN 作为拥有全部权限的 default key 继续有效
+type KeyStore struct {
+    mu         sync.Mutex
+    path       string
+    keys       []*APIKey
+    flushTimer *time.Timer
+}
+
+// keyStore 在 Init 中按 KEYS_FILE 加载，此前只保存在内存中
+var keyStore = NewKeyStore("")
+
+// keyStoreFilePath API key 文件的路径，KEYS_FILE=off 时只保存在内存中
+func keyStoreFilePath() string {
+    path := os.Getenv("KEYS_FILE")
+    switch path {
+    case "":
+        return "data/keys.json"
+    case "off":
+        return ""
+    default:
+        return path
+    }
+}
+
+// NewKeyStore 创建 key 存储并加载 path 中已有的 key，path 为空时不持久化
+func NewKeyStore(path string) *KeyStore {
+    s := &KeyStore{path: path}
+    if path == "" {
+        return s
+    }
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        if !errors.Is(err, os.ErrNotExist) {
+            log.Warnf("failed to read keys file: %v", err)
+        }
+        return s
+    }
+    if err := json.Unmarshal(data, &s.keys); err != nil {
+        log.Errorf("ignoring invalid keys file %s: %v", path, err)
+        return s
+    }
+    log.Infof("loaded %d api keys from %s", len(s.keys), path)
+    return s
+}
+
+// APIKeys 返回全局的 key 存储
+func APIKeys() *KeyStore {
+    return keyStore
+}
+
+// Create 创建 key，返回只会出现这一次的明文密钥
+func (s *KeyStore) Create(params NewAPIKey) (string, APIKeyInfo, error) {
+    scopes := make([]string, 0, len(params.Scopes))
+    for _, scope := range params.Scopes {
+        scope = strings.ToLower(strings.TrimSpace(scope))
+        if !containsFold(AllScopes, scope) {
+            return "", APIKeyInfo{}, &InputError{Param: "scopes", Message: fmt.Sprintf("unknown scope %q, supported: %s", scope, supportedList(AllScopes))}
+        }
+        scopes = append(scopes, scope)
+    }
+    params.Scopes = scopes
+    if len(params.Scopes) == 0 {
+        return "", APIKeyInfo{}, &InputError{Param: "scopes", Message: "at least one scope is required"}
+    }
+    if params.DailyChars < 0 {
+        return "", APIKeyInfo{}, &InputError{Param: "daily_chars", Message: "daily_chars must not be negative"}
+    }
+
+    id, err := randomHex(8)
+    if err != nil {
+        return "", APIKeyInfo{}, err
+    }
+    secret, err := randomHex(24)
+    if err != nil {
+        return "", APIKeyInfo{}, err
+    }
+    secret = "sk-" + secret
+
+    key := &APIKey{
+        ID:            id,
+        Label:         params.Label,
+        Hash:          hashAPIKey(secret),
+        Prefix:        secret[:7],
+        Scopes:        params.Scopes,
+        ExpiresAt:     params.ExpiresAt,
+        CreatedAt:     time.Now().UTC(),
+        DailyChars:    params.DailyChars,
+        AllowedVoices: params.AllowedVoices,
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.keys = append(s.keys, key)
+    if err := s.saveLocked(); err != nil {
+        s.keys = s.keys[:len(s.keys)-1]
+        return "", APIKeyInfo{}, err
+    }
+    return secret, key.Info(), nil
+}
+
+// List 返回全部 key，包括已撤销的
+func (s *KeyStore) List() []APIKeyInfo {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    infos := make([]APIKeyInfo, 0, len(s.keys))
+    for _, key := range s.keys {
+        infos = append(infos, key.Info())
+    }
+    return infos
+}
+
+// Revoke 撤销 key，撤销后立即失效
+func (s *KeyStore) Revoke(id string) (APIKeyInfo, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for _, key := range s.keys {
+        if key.ID != id {
+            continue
+        }
+        if key.RevokedAt == nil {
+            now := time.Now().UTC()
+            key.RevokedAt = &now
+            if err := s.saveLocked(); err != nil {
+                key.RevokedAt = nil
+                return APIKeyInfo{}, err
+            }
+        }
+        return key.Info(), nil
+    }
+    return APIKeyInfo{}, ErrAPIKeyNotFound
+}
+
+// Authenticate 校验明文密钥，返回 key 的副本，比较时间与密钥内容无关
+func (s *KeyStore) Authenticate(secret string) (*APIKey, error) {
+    if secret == "" {
+        return nil, ErrInvalidAPIKey
+    }
+    if legacy := os.Getenv("SECRET_TOKEN"); legacy != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(legacy)) == 1 {
+        return legacyKey(), nil
+    }
+
+    hash := []byte(hashAPIKey(secret))
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var found *APIKey
+    for _, key := range s.keys {
+        if subtle.ConstantTimeCompare(hash, []byte(key.Hash)) == 1 {
+            found = key
+        }
+    }
+    if found == nil {
+        return nil, ErrInvalidAPIKey
+    }
+    return found.active()
+}
+
+// Lookup 按 id 返回仍然有效的 key 的副本，用于签名链接等不携带密钥的认证方式
+func (s *KeyStore) Lookup(id string) (*APIKey, error) {
+    if id == legacyKeyID {
+        if os.Getenv("SECRET_TOKEN") == "" {
+            return nil, ErrAPIKeyNotFound
+        }
+        return legacyKey(), nil
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for _, key := range s.keys {
+        if key.ID == id {
+            return key.active()
+        }
+    }
+    return nil, ErrAPIKeyNotFound
+}
+
+// active 检查 key 是否已撤销或过期，有效时返回副本，调用方需持有锁
+func (k *APIKey) active() (*APIKey, error) {
+    if k.RevokedAt != nil {
+        return nil, ErrAPIKeyRevoked
+    }
+    if k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt) {
+        return nil, ErrAPIKeyExpired
+    }
+
+    key := *k
+    return &key, nil
+}
+
+// ConsumeChars 记录 key 合成的字符数，超过每日配额时返回 ErrQuotaExceeded 且不计入
+func (s *KeyStore) ConsumeChars(id string, chars int) error {
+    if id == legacyKeyID || chars <= 0 {
+        return nil
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for _, key := range s.keys {
+        if key.ID != id {
+            continue
+        }
+        used := key.usedToday()
+        if key.DailyChars > 0 && used+chars > key.DailyChars {
+            return fmt.Errorf("%w: %d of %d characters used today", ErrQuotaExceeded, used, key.DailyChars)
+        }
+        key.UsageDay = usageDay()
+        key.UsageChars = used + chars
+        s.scheduleFlushLocked()
+        return nil
+    }
+    return ErrAPIKeyNotFound
+}
+
+// RefundChars 退回 ConsumeChars 扣除的字符，例如请求参数不合法或合成失败时，跨天后不再退回
+func (s *KeyStore) RefundChars(id string, chars int) {
+    if id == legacyKeyID || chars <= 0 {
+        return
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    for _, key := range s.keys {
+        if key.ID != id || key.UsageDay != usageDay() {
+            continue
+        }
+        key.UsageChars = max(key.UsageChars-chars, 0)
+        s.scheduleFlushLocked()
+        return
+    }
+}
+
+// scheduleFlushLocked 延迟保存用量，调用方需持有锁
+func (s *KeyStore) scheduleFlushLocked() {
+    if s.path == "" || s.flushTimer != nil {
+        return
+    }
+    s.flushTimer = time.AfterFunc(keyUsageFlushDelay, func() {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        s.flushTimer = nil
+        if err := s.saveLocked(); err != nil {
+            log.Warnf("failed to save api key usage: %v", err)
+        }
+    })
+}
+
+// Flush 立即保存尚未写入文件的用量，用于退出前
+func (s *KeyStore) Flush() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.flushTimer == nil {
+        return nil
+    }
+    s.flushTimer.Stop()
+    s.flushTimer = nil
+    return s.saveLocked()
+}
+
+// saveLocked 先写临时文件再重命名，调用方需持有锁
+func (s *KeyStore) saveLocked() error {
+    if s.path == "" {
+        return nil
+    }
+
+    data, err := json.MarshalIndent(s.keys, "", "  ")
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+        return err
+    }
+    tmp := s.path + ".tmp"
+    if err := os.WriteFile(tmp, data, 0o600); err != nil {
+        return err
+    }
+    return os.Rename(tmp, s.path)
+}
+
+func hashAPIKey(secret string) string {
+    sum := sha256.Sum256([]byte(secret))
+    return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+    buf := make([]byte, n)
+    if _, err := rand.Read(buf); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+    "regexp"
+    "strings"
+)
+
+// fallbackLocale 无法确定语音区域时使用的默认值
+const fallbackLocale = "zh-CN"
+
+var (
+    langPattern      = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+    voiceNamePattern = regexp.MustCompile(`^([a-z]{2,3}-[A-Z]{2})-`)
+)
+
+// validateLang 检查语言标签格式，如 en-US、zh-CN
+func validateLang(lang string) error {
+    if lang != "" && !langPattern.MatchString(lang) {
+        return &InputError{Param: "lang", Message: "lang must be a language tag such as en-US"}
+    }
+    return nil
+}
+
+// localeFromVoiceName 从语音名称中解析区域，如 en-US-JennyNeural 返回 en-US
+func localeFromVoiceName(voiceName string) string {
+    if m := voiceNamePattern.FindStringSubmatch(voiceName); m != nil {
+        return m[1]
+    }
+    return fallbackLocale
+}
+
+// resolveVoiceLocale 从已缓存的语音列表中查找语音的区域，并判断是否为多语言语音；
+// 不等待获取语音列表，没有缓存时直接从语音名称推断
+func resolveVoiceLocale(voiceName string) (string, bool) {
+    multilingual := strings.Contains(voiceName, "Multilingual")
+
+    voice, ok := FindVoice(voiceCache.Cached(), voiceName)
+    if !ok {
+        return localeFromVoiceName(voiceName), multilingual
+    }
+
+    locale := voice.Locale
+    if locale == "" {
+        locale = localeFromVoiceName(voiceName)
+    }
+    return locale, multilingual || voice.IsMultilingual()
+}
+
+// ssmlLangs 返回 speak 元素的 xml:lang 以及正文需要包裹的 lang 元素语言
+func ssmlLangs(opts SpeechOptions) (string, string) {
+    locale := opts.locale
+    if locale == "" {
+        locale = localeFromVoiceName(opts.VoiceName)
+    }
+    if opts.Lang == "" || strings.EqualFold(opts.Lang, locale) {
+        return locale, ""
+    }
+    // 多语言语音保留自身区域，用 lang 元素切换正文语言
+    if opts.multilingual || strings.Contains(opts.VoiceName, "Multilingual") {
+        return locale, opts.Lang
+    }
+    return opts.Lang, ""
+}
@@ -0,0 +1,186 @@
+package utils
+
+import (
+    "bytes"
+    "context"
+    "io"
+    "sync"
+    "time"
+)
+
+type chunkResult struct {
+    data []byte
+    err  error
+}
+
+// chunkedReader 分段合成的输出流，关闭时取消仍在进行的分段
+type chunkedReader struct {
+    *io.PipeReader
+    cancel context.CancelFunc
+}
+
+func (r *chunkedReader) Close() error {
+    r.cancel()
+    return r.PipeReader.Close()
+}
+
+// synthesizeChunks 以有限的并发合成各个分段，并按顺序拼接输出
+func synthesizeChunks(ctx context.Context, opts SpeechOptions, chunks []string) (io.ReadCloser, error) {
+    log.Infof("Synthesizing long text in %d chunks, concurrency: %d", len(chunks), chunkConcurrency)
+
+    ctx, cancel := context.WithCancel(ctx)
+    results := make([]chan chunkResult, len(chunks))
+    for i := range results {
+        results[i] = make(chan chunkResult, 1)
+    }
+
+    go func() {
+        sem := make(chan struct{}, chunkConcurrency)
+        for i, chunk := range chunks {
+            select {
+            case sem <- struct{}{}:
+            case <-ctx.Done():
+                for j := i; j < len(chunks); j++ {
+                    results[j] <- chunkResult{err: ctx.Err()}
+                }
+                return
+            }
+            go func(i int, chunk string) {
+                defer func() { <-sem }()
+                chunkOpts := opts
+                chunkOpts.Text = chunk
+                data, err := synthesizeChunk(ctx, chunkOpts)
+                results[i] <- chunkResult{data: data, err: err}
+            }(i, chunk)
+        }
+    }()
+
+    // 等待第一段完成，使参数或鉴权错误能以正确的状态码返回
+    first := <-results[0]
+    if first.err != nil {
+        cancel()
+        return nil, first.err
+    }
+
+    if !isAppendable(opts.OutputFormat) {
+        defer cancel()
+        parts := [][]byte{first.data}
+        for _, result := range results[1:] {
+            r := <-result
+            if r.err != nil {
+                return nil, r.err
+            }
+            parts = append(parts, r.data)
+        }
+        audio, err := ConcatAudio(opts.OutputFormat, parts)
+        if err != nil {
+            return nil, err
+        }
+        return io.NopCloser(bytes.NewReader(audio)), nil
+    }
+
+    // MP3、PCM 等格式可以逐段输出
+    pr, pw := io.Pipe()
+    go func() {
+        defer cancel()
+        if _, err := pw.Write(first.data); err != nil {
+            return
+        }
+        for _, result := range results[1:] {
+            r := <-result
+            if r.err != nil {
+                pw.CloseWithError(r.err)
+                return
+            }
+            if _, err := pw.Write(continuationPart(opts.OutputFormat, r.data)); err != nil {
+                return
+            }
+        }
+        pw.Close()
+    }()
+
+    return &chunkedReader{PipeReader: pr, cancel: cancel}, nil
+}
+
+func synthesizeChunk(ctx context.Context, opts SpeechOptions) ([]byte, error) {
+    ssml, err := BuildSsml(opts)
+    if err != nil {
+        return nil, err
+    }
+    body, err := SynthesizeSsmlStream(ctx, ssml, opts.OutputFormat)
+    if err != nil {
+        return nil, err
+    }
+    defer body.Close()
+    return io.ReadAll(body)
+}
+
+// synthesizeChunksWithMetadata 以有限的并发合成各个分段的音频和元数据事件，
+// 按顺序拼接音频，并将每段事件的偏移加上之前各段的音频时长
+func synthesizeChunksWithMetadata(ctx context.Context, opts SpeechOptions, chunks []string) ([]byte, []SynthesisEvent, error) {
+    log.Infof("Synthesizing long text with metadata in %d chunks, concurrency: %d", len(chunks), chunkConcurrency)
+
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    audios := make([][]byte, len(chunks))
+    events := make([][]SynthesisEvent, len(chunks))
+    var (
+        wg       sync.WaitGroup
+        mu       sync.Mutex
+        firstErr error
+    )
+    sem := make(chan struct{}, chunkConcurrency)
+    for i, chunk := range chunks {
+        wg.Add(1)
+        go func(i int, chunk string) {
+            defer wg.Done()
+            select {
+            case sem <- struct{}{}:
+            case <-ctx.Done():
+                return
+            }
+            defer func() { <-sem }()
+
+            chunkOpts := opts
+            chunkOpts.Text = chunk
+            ssml, err := BuildSsml(chunkOpts)
+            if err == nil {
+                audios[i], events[i], err = synthesizeWithEvents(ctx, ssml, opts.OutputFormat)
+            }
+            if err != nil {
+                // 只保留第一个错误，其余分段因取消而失败
+                mu.Lock()
+                if firstErr == nil {
+                    firstErr = err
+                }
+                mu.Unlock()
+                cancel()
+            }
+        }(i, chunk)
+    }
+    wg.Wait()
+
+    if firstErr != nil {
+        return nil, nil, firstErr
+    }
+    if err := ctx.Err(); err != nil {
+        return nil, nil, err
+    }
+
+    audio, err := ConcatAudio(opts.OutputFormat, audios)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    var all []SynthesisEvent
+    var offset time.Duration
+    for i := range chunks {
+        for _, event := range events[i] {
+            event.Offset += offset
+            all = append(all, event)
+        }
+        offset += audioDuration(opts.OutputFormat, audios[i], events[i])
+    }
+    return audio, all, nil
+}
@@ -0,0 +1,259 @@
+package utils
+
+import (
+    "context"
+    "errors"
+    "io"
+    "net/http"
+    "os"
+    "strings"
+)
+
+// 语音合成服务提供方的名称
+const (
+    // ProviderTranslator 微软翻译应用的端点，无需密钥
+    ProviderTranslator = "translator"
+    // ProviderAzure 使用 Azure 语音服务的订阅密钥
+    ProviderAzure = "azure"
+)
+
+// Synthesizer 将完整的 SSML 文档合成为音频
+type Synthesizer interface {
+    Name() string
+    // SynthesizeSsml 按 SYNTHESIS_BACKEND 选择 REST 或 WebSocket 协议合成
+    SynthesizeSsml(ctx context.Context, ssml, outputFormat string) (io.ReadCloser, error)
+    // SynthesizeSsmlWithEvents 通过 WebSocket 协议合成，元数据事件通过 onEvent 回调
+    SynthesizeSsmlWithEvents(ctx context.Context, ssml, outputFormat string, onEvent func(SynthesisEvent)) (io.ReadCloser, error)
+}
+
+// VoiceProvider 提供可用的语音列表
+type VoiceProvider interface {
+    Name() string
+    Voices(ctx context.Context) ([]Voice, error)
+}
+
+// Provider 同时提供语音合成和语音列表
+type Provider interface {
+    Synthesizer
+    VoiceProvider
+}
+
+// ProviderState 用于诊断输出的提供方状态
+type ProviderState struct {
+    Name  string     `json:"name"`
+    Token TokenState `json:"token"`
+}
+
+// speechCredentials 调用合成接口所需的区域和 Authorization 头
+type speechCredentials struct {
+    Region        string
+    Authorization string
+}
+
+// speechProvider 通过 token 授权的语音合成服务，翻译应用和 Azure 订阅密钥只是获取 token 的方式不同
+type speechProvider struct {
+    name   string
+    tokens *TokenManager
+    // bearer 为 true 时 Authorization 头带 Bearer 前缀
+    bearer bool
+    voices func(ctx context.Context) ([]Voice, error)
+}
+
+var (
+    translatorProvider = &speechProvider{
+        name:   ProviderTranslator,
+        tokens: tokenManager,
+        voices: fetchVoiceList,
+    }
+    // providers 在 Init 中按 TTS_PROVIDERS 重新创建
+    providers = []Provider{translatorProvider}
+)
+
+// NewAzureProvider 创建使用 Azure 语音服务订阅密钥的提供方
+func NewAzureProvider(key, region string) Provider {
+    return &speechProvider{
+        name: ProviderAzure,
+        tokens: NewTokenManager(func(ctx context.Context) (map[string]interface{}, error) {
+            return issueAzureToken(ctx, key, region)
+        }),
+        bearer: true,
+        voices: func(ctx context.Context) ([]Voice, error) {
+            return fetchAzureVoiceList(ctx, key, region)
+        },
+    }
+}
+
+// loadProviders 按 TTS_PROVIDERS 的顺序创建提供方，未设置时配置了 AZURE_SPEECH_KEY 则优先使用 Azure
+func loadProviders() []Provider {
+    key := os.Getenv("AZURE_SPEECH_KEY")
+    region := os.Getenv("AZURE_SPEECH_REGION")
+
+    names := os.Getenv("TTS_PROVIDERS")
+    if names == "" {
+        names = ProviderTranslator
+        if key != "" {
+            names = ProviderAzure + "," + ProviderTranslator
+        }
+    }
+
+    var result []Provider
+    for _, name := range strings.Split(names, ",") {
+        switch strings.ToLower(strings.TrimSpace(name)) {
+        case ProviderTranslator:
+            result = append(result, translatorProvider)
+        case ProviderAzure:
+            if key == "" || region == "" {
+                log.Warn("azure provider requires AZURE_SPEECH_KEY and AZURE_SPEECH_REGION, skipped")
+                continue
+            }
+            result = append(result, NewAzureProvider(key, region))
+        case "":
+        default:
+            log.Warnf("unknown tts provider %q, skipped", name)
+        }
+    }
+
+    if len(result) == 0 {
+        result = append(result, translatorProvider)
+    }
+    return result
+}
+
+func (p *speechProvider) Name() string {
+    return p.name
+}
+
+func (p *speechProvider) credentials(ctx context.Context) (*speechCredentials, error) {
+    token, err := p.tokens.GetContext(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    authorization := token.Token
+    if p.bearer {
+        authorization = "Bearer " + token.Token
+    }
+    return &speechCredentials{Region: token.Region, Authorization: authorization}, nil
+}
+
+func (p *speechProvider) SynthesizeSsml(ctx context.Context, ssml, outputFormat string) (io.ReadCloser, error) {
+    if synthesisBackend == "websocket" {
+        return p.SynthesizeSsmlWithEvents(ctx, ssml, outputFormat, nil)
+    }
+
+    cred, err := p.credentials(ctx)
+    if err != nil {
+        return nil, err
+    }
+    body, err := synthesizeRESTStream(ctx, cred, ssml, outputFormat)
+    return body, p.checkAuth(err)
+}
+
+func (p *speechProvider) SynthesizeSsmlWithEvents(ctx context.Context, ssml, outputFormat string, onEvent func(SynthesisEvent)) (io.ReadCloser, error) {
+    cred, err := p.credentials(ctx)
+    if err != nil {
+        return nil, err
+    }
+    body, err := synthesizeWebSocketStream(ctx, cred, ssml, outputFormat, onEvent)
+    return body, p.checkAuth(err)
+}
+
+func (p *speechProvider) Voices(ctx context.Context) ([]Voice, error) {
+    return p.voices(ctx)
+}
+
+// checkAuth token 被拒绝时丢弃缓存，下次请求重新获取
+func (p *speechProvider) checkAuth(err error) error {
+    if errors.Is(err, ErrUpstreamAuth) {
+        p.tokens.Invalidate()
+    }
+    return err
+}
+
+// issueAzureToken 使用订阅密钥换取 10 分钟有效的访问 token
+func issueAzureToken(ctx context.Context, key, region string) (map[string]interface{}, error) {
+    req, err := http.NewRequestWithContext(ctx, "POST", regionURL(GetUpstreamURLs().AzureToken, region), nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Ocp-Apim-Subscription-Key", key)
+    req.Header.Set("Content-Length", "0")
+
+    resp, err := client.Do(req)
+    if err != nil {
+        log.Error("failed to do request: ", err)
+        return nil, err
+    }
+    if err := checkResponse(resp); err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    token, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+    if err != nil {
+        return nil, err
+    }
+
+    return map[string]interface{}{
+        "r": region,
+        "t": strings.TrimSpace(string(token)),
+    }, nil
+}
+
+// fetchAzureVoiceList 获取订阅所在区域的语音列表
+func fetchAzureVoiceList(ctx context.Context, key, region string) ([]Voice, error) {
+    req, err := http.NewRequestWithContext(ctx, "GET", speechURL(region, "/cognitiveservices/voices/list"), nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Ocp-Apim-Subscription-Key", key)
+
+    return doVoiceListRequest(req)
+}
+
+// shouldFallback 判断失败后是否尝试下一个提供方，参数错误或请求已结束时不切换
+func shouldFallback(ctx context.Context, err error) bool {
+    if ctx.Err() != nil {
+        return false
+    }
+    return !errors.Is(err, ErrInvalidSSML) &&
+        !errors.Is(err, ErrUnsupportedFormat) &&
+        !errors.Is(err, ErrInvalidInput)
+}
+
+// withFallback 依次使用各提供方执行 fn，直到成功或遇到不应切换的错误
+func withFallback[T any](ctx context.Context, op string, fn func(p Provider) (T, error)) (T, error) {
+    var result T
+    var err error
+    for i, p := range providers {
+        result, err = fn(p)
+        if err == nil {
+            return result, nil
+        }
+        if i == len(providers)-1 || !shouldFallback(ctx, err) {
+            break
+        }
+        log.Warnf("provider %s failed to %s, falling back to %s: %v", p.Name(), op, providers[i+1].Name(), err)
+    }
+    return result, err
+}
+
+// fetchProviderVoices 从第一个可用的提供方获取语音列表
+func fetchProviderVoices(ctx context.Context) ([]Voice, error) {
+    return withFallback(ctx, "fetch voice list", func(p Provider) ([]Voice, error) {
+        return p.Voices(ctx)
+    })
+}
+
+// GetProviderStates 返回各提供方的诊断信息，顺序即回退顺序
+func GetProviderStates() []ProviderState {
+    states := make([]ProviderState, 0, len(providers))
+    for _, p := range providers {
+        state := ProviderState{Name: p.Name()}
+        if sp, ok := p.(*speechProvider); ok {
+            state.Token = sp.tokens.State()
+        }
+        states = append(states, state)
+    }
+    return states
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+    "net"
+    "os"
+    "strings"
+)
+
+// 受信任的反向代理，在 Init 中按 TRUSTED_PROXIES 读取，只有来自这些地址的请求才采用 X-Forwarded-* 头
+var (
+    trustedProxies   []string
+    trustedProxyNets []*net.IPNet
+)
+
+// loadTrustedProxies 读取 TRUSTED_PROXIES，逗号分隔的 IP 或 CIDR，任一项无效时不信任任何代理
+func loadTrustedProxies() {
+    trustedProxies, trustedProxyNets = nil, nil
+
+    var proxies []string
+    var nets []*net.IPNet
+    for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+        if proxy = strings.TrimSpace(proxy); proxy == "" {
+            continue
+        }
+        ipNet, err := parseProxy(proxy)
+        if err != nil {
+            log.Errorf("Invalid TRUSTED_PROXIES entry %q, using the connection address as client IP: %v", proxy, err)
+            return
+        }
+        proxies = append(proxies, proxy)
+        nets = append(nets, ipNet)
+    }
+    trustedProxies, trustedProxyNets = proxies, nets
+}
+
+// parseProxy 将单个 IP 视为只包含它自己的网段
+func parseProxy(proxy string) (*net.IPNet, error) {
+    if strings.Contains(proxy, "/") {
+        _, ipNet, err := net.ParseCIDR(proxy)
+        return ipNet, err
+    }
+    ip := net.ParseIP(proxy)
+    if ip == nil {
+        return nil, &net.ParseError{Type: "IP address", Text: proxy}
+    }
+    bits := 8 * net.IPv6len
+    if ip.To4() != nil {
+        ip, bits = ip.To4(), 8*net.IPv4len
+    }
+    return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// TrustedProxies 返回 TRUSTED_PROXIES 中的代理地址，未设置时为空
+func TrustedProxies() []string {
+    return trustedProxies
+}
+
+// IsTrustedProxy 判断 ip 是否为受信任的反向代理
+func IsTrustedProxy(ip string) bool {
+    parsed := net.ParseIP(ip)
+    if parsed == nil {
+        return false
+    }
+    for _, ipNet := range trustedProxyNets {
+        if ipNet.Contains(parsed) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,34 @@
+package utils
+
+import "testing"
+
+func TestIsTrustedProxy(t *testing.T) {
+    t.Setenv("TRUSTED_PROXIES", "127.0.0.1, 10.0.0.0/8,::1")
+    loadTrustedProxies()
+    t.Cleanup(func() { trustedProxies, trustedProxyNets = nil, nil })
+
+    tests := map[string]bool{
+        "127.0.0.1":   true,
+        "10.20.30.40": true,
+        "::1":         true,
+        "127.0.0.2":   false,
+        "192.0.2.1":   false,
+        "":            false,
+        "not-an-ip":   false,
+    }
+    for ip, want := range tests {
+        if got := IsTrustedProxy(ip); got != want {
+            t.Errorf("IsTrustedProxy(%q) = %v, want %v", ip, got, want)
+        }
+    }
+    if got := len(TrustedProxies()); got != 3 {
+        t.Errorf("TrustedProxies() has %d entries, want 3", got)
+    }
+
+    // 任一项无效时不信任任何代理
+    t.Setenv("TRUSTED_PROXIES", "127.0.0.1,proxy.local")
+    loadTrustedProxies()
+    if IsTrustedProxy("127.0.0.1") || len(TrustedProxies()) != 0 {
+        t.Errorf("invalid TRUSTED_PROXIES still trusts %v", TrustedProxies())
+    }
+}
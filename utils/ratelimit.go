@@ -0,0 +1,212 @@
+package utils
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// 限流的计量单位
+const (
+    RateLimitRequests   = "requests"
+    RateLimitCharacters = "characters"
+)
+
+// ErrRateLimited 请求或字符数超过限流，可通过 errors.Is 判断
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// 每分钟的请求数和合成字符数上限，分别按 API key 和客户端 IP 计算，0 为不限制
+var (
+    keyRequestLimiter = NewRateLimiter(60)
+    ipRequestLimiter  = NewRateLimiter(120)
+    keyCharLimiter    = NewRateLimiter(50000)
+    ipCharLimiter     = NewRateLimiter(100000)
+)
+
+// loadRateLimiters 按 RATE_LIMIT_* 环境变量重新创建限流器
+func loadRateLimiters() {
+    keyRequestLimiter = NewRateLimiter(getNonNegativeInt("RATE_LIMIT_KEY_RPM", 60))
+    ipRequestLimiter = NewRateLimiter(getNonNegativeInt("RATE_LIMIT_IP_RPM", 120))
+    keyCharLimiter = NewRateLimiter(getNonNegativeInt("RATE_LIMIT_KEY_CPM", 50000))
+    ipCharLimiter = NewRateLimiter(getNonNegativeInt("RATE_LIMIT_IP_CPM", 100000))
+}
+
+// RateLimit 一次限流检查的结果，Limit 为 0 表示未限制
+type RateLimit struct {
+    Allowed   bool
+    Limit     int
+    Remaining int
+    // Reset 令牌桶恢复满额所需的时间
+    Reset time.Duration
+    // RetryAfter 被拒绝时需要等待的时间
+    RetryAfter time.Duration
+}
+
+// Headers 返回 X-RateLimit-* 响应头，unit 为 RateLimitRequests 或 RateLimitCharacters，未限制时返回空
+func (r RateLimit) Headers(unit string) map[string]string {
+    if r.Limit == 0 {
+        return nil
+    }
+    suffix := "Requests"
+    if unit == RateLimitCharacters {
+        suffix = "Characters"
+    }
+    return map[string]string{
+        "X-RateLimit-Limit-" + suffix:     strconv.Itoa(r.Limit),
+        "X-RateLimit-Remaining-" + suffix: strconv.Itoa(r.Remaining),
+        "X-RateLimit-Reset-" + suffix:     r.Reset.Round(time.Millisecond).String(),
+    }
+}
+
+// RateLimitError 超过限流时返回的错误
+type RateLimitError struct {
+    // Unit 为 RateLimitRequests 或 RateLimitCharacters
+    Unit       string
+    RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+    return fmt.Sprintf("%v for %s, retry after %s", ErrRateLimited, e.Unit, retryAfterSeconds(e.RetryAfter)+"s")
+}
+
+func (e *RateLimitError) Unwrap() error {
+    return ErrRateLimited
+}
+
+// retryAfterSeconds 向上取整的秒数，用于 Retry-After
+func retryAfterSeconds(d time.Duration) string {
+    seconds := int64(math.Ceil(d.Seconds()))
+    if seconds < 1 {
+        seconds = 1
+    }
+    return strconv.FormatInt(seconds, 10)
+}
+
+type tokenBucket struct {
+    tokens float64
+    last   time.Time
+}
+
+// RateLimiter 按 id 分别计算的令牌桶，容量为每分钟的上限，令牌匀速恢复
+type RateLimiter struct {
+    mu        sync.Mutex
+    limit     float64
+    rate      float64
+    buckets   map[string]*tokenBucket
+    lastSweep time.Time
+}
+
+// NewRateLimiter 创建每分钟最多 perMinute 个令牌的限流器，perMinute 为 0 时不限制
+func NewRateLimiter(perMinute int) *RateLimiter {
+    return &RateLimiter{
+        limit:   float64(perMinute),
+        rate:    float64(perMinute) / 60,
+        buckets: make(map[string]*tokenBucket),
+    }
+}
+
+// Enabled 判断是否启用了限流
+func (l *RateLimiter) Enabled() bool {
+    return l.limit > 0
+}
+
+// Take 从 id 的令牌桶中取出 n 个令牌，不足时不扣除并返回需要等待的时间。
+// n 超过容量时只要求桶是满的，但仍扣除全部 n 个令牌，桶变为负数，超出的部分以之后的等待时间偿还
+func (l *RateLimiter) Take(id string, n int) RateLimit {
+    if !l.Enabled() {
+        return RateLimit{Allowed: true}
+    }
+
+    now := time.Now()
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.sweepLocked(now)
+
+    b := l.refillLocked(id, now)
+    need := math.Min(float64(n), l.limit)
+    result := RateLimit{Limit: int(l.limit)}
+    if b.tokens >= need {
+        b.tokens -= float64(n)
+        result.Allowed = true
+    } else {
+        result.RetryAfter = time.Duration((need - b.tokens) / l.rate * float64(time.Second))
+    }
+    result.Remaining = max(int(b.tokens), 0)
+    result.Reset = time.Duration((l.limit - b.tokens) / l.rate * float64(time.Second))
+    return result
+}
+
+// Give 归还 Take 扣除的令牌，用于多个限流器中后面的拒绝时撤销前面的扣除，或请求最终没有执行时
+func (l *RateLimiter) Give(id string, n int) {
+    if !l.Enabled() {
+        return
+    }
+
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    b := l.refillLocked(id, time.Now())
+    b.tokens = math.Min(l.limit, b.tokens+float64(n))
+}
+
+// refillLocked 返回 id 的令牌桶并按经过的时间补充令牌，调用方需持有锁
+func (l *RateLimiter) refillLocked(id string, now time.Time) *tokenBucket {
+    b, ok := l.buckets[id]
+    if !ok {
+        b = &tokenBucket{tokens: l.limit, last: now}
+        l.buckets[id] = b
+        return b
+    }
+    b.tokens = math.Min(l.limit, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+    b.last = now
+    return b
+}
+
+// sweepLocked 每分钟清理一次已经恢复满额的令牌桶，调用方需持有锁
+func (l *RateLimiter) sweepLocked(now time.Time) {
+    if now.Sub(l.lastSweep) < time.Minute {
+        return
+    }
+    l.lastSweep = now
+    for id, b := range l.buckets {
+        if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.limit {
+            delete(l.buckets, id)
+        }
+    }
+}
+
+// takeBoth 同时按 key 和 IP 扣除，任一被拒绝时都不扣除，返回剩余较少的一方
+func takeBoth(keyLimiter, ipLimiter *RateLimiter, keyID, ip string, n int, unit string) (RateLimit, error) {
+    byKey := keyLimiter.Take(keyID, n)
+    if !byKey.Allowed {
+        return byKey, &RateLimitError{Unit: unit, RetryAfter: byKey.RetryAfter}
+    }
+    byIP := ipLimiter.Take(ip, n)
+    if !byIP.Allowed {
+        keyLimiter.Give(keyID, n)
+        return byIP, &RateLimitError{Unit: unit, RetryAfter: byIP.RetryAfter}
+    }
+
+    if byKey.Limit == 0 || (byIP.Limit > 0 && byIP.Remaining < byKey.Remaining) {
+        return byIP, nil
+    }
+    return byKey, nil
+}
+
+// AllowRequest 按 API key 和客户端 IP 计入一次请求，超过限流时返回 *RateLimitError
+func AllowRequest(keyID, ip string) (RateLimit, error) {
+    return takeBoth(keyRequestLimiter, ipRequestLimiter, keyID, ip, 1, RateLimitRequests)
+}
+
+// AllowCharacters 按 API key 和客户端 IP 计入合成的字符数，超过限流时返回 *RateLimitError
+func AllowCharacters(keyID, ip string, chars int) (RateLimit, error) {
+    return takeBoth(keyCharLimiter, ipCharLimiter, keyID, ip, chars, RateLimitCharacters)
+}
+
+// RefundCharacters 退回 AllowCharacters 计入的字符，用于请求最终没有合成的情况
+func RefundCharacters(keyID, ip string, chars int) {
+    keyCharLimiter.Give(keyID, chars)
+    ipCharLimiter.Give(ip, chars)
+}
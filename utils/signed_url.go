@@ -0,0 +1,84 @@
+package utils
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/base64"
+    "errors"
+    "net/http"
+    "net/url"
+    "os"
+    "strconv"
+    "time"
+)
+
+// 签名链接的查询参数
+const (
+    SignedURLKeyID     = "kid"
+    SignedURLExpires   = "exp"
+    SignedURLSignature = "sig"
+)
+
+var (
+    ErrSignatureInvalid = errors.New("invalid url signature")
+    ErrSignatureExpired = errors.New("signed url expired")
+)
+
+// shareSecret 签名链接的 HMAC 密钥，未设置 SHARE_SECRET 时由 SECRET_TOKEN 派生，
+// 修改任一值都会使已发出的链接失效
+func shareSecret() []byte {
+    if secret := os.Getenv("SHARE_SECRET"); secret != "" {
+        return []byte(secret)
+    }
+    sum := sha256.Sum256([]byte("ms-tts-go share url\x00" + os.Getenv("SECRET_TOKEN")))
+    return sum[:]
+}
+
+// urlSignature 对请求方法、路径和除 sig 之外按名称排序的查询参数签名
+func urlSignature(method, path string, query url.Values) string {
+    unsigned := url.Values{}
+    for name, values := range query {
+        if name != SignedURLSignature {
+            unsigned[name] = values
+        }
+    }
+
+    mac := hmac.New(sha256.New, shareSecret())
+    mac.Write([]byte(method + "\n" + path + "\n" + unsigned.Encode()))
+    return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignURL 为 GET path 生成签名后的查询参数，链接以 keyID 的身份访问并在 expiresAt 后失效
+func SignURL(path string, query url.Values, keyID string, expiresAt time.Time) url.Values {
+    signed := url.Values{}
+    for name, values := range query {
+        signed[name] = values
+    }
+    signed.Del(SignedURLSignature)
+    signed.Set(SignedURLKeyID, keyID)
+    signed.Set(SignedURLExpires, strconv.FormatInt(expiresAt.Unix(), 10))
+    signed.Set(SignedURLSignature, urlSignature(http.MethodGet, path, signed))
+    return signed
+}
+
+// AuthenticateSignedURL 校验签名链接，返回签发链接的 key；参数被修改、链接过期或 key 已失效时返回错误
+func AuthenticateSignedURL(method, path string, query url.Values) (*APIKey, error) {
+    if method != http.MethodGet && method != http.MethodHead {
+        return nil, ErrSignatureInvalid
+    }
+
+    expected := urlSignature(http.MethodGet, path, query)
+    if !hmac.Equal([]byte(query.Get(SignedURLSignature)), []byte(expected)) {
+        return nil, ErrSignatureInvalid
+    }
+
+    exp, err := strconv.ParseInt(query.Get(SignedURLExpires), 10, 64)
+    if err != nil {
+        return nil, ErrSignatureInvalid
+    }
+    if time.Now().Unix() > exp {
+        return nil, ErrSignatureExpired
+    }
+
+    return keyStore.Lookup(query.Get(SignedURLKeyID))
+}
@@ -0,0 +1,198 @@
+package utils
+
+import (
+    "bytes"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// ErrInvalidInput 请求参数无法生成合法的 SSML
+var ErrInvalidInput = errors.New("invalid input")
+
+// InputError 描述具体是哪个参数不合法
+type InputError struct {
+    Param   string
+    Message string
+}
+
+func (e *InputError) Error() string {
+    return fmt.Sprintf("invalid %s: %s", e.Param, e.Message)
+}
+
+func (e *InputError) Unwrap() error {
+    return ErrInvalidInput
+}
+
+// InvalidParam 返回不合法的参数名，非 InputError 时返回空字符串
+func InvalidParam(err error) string {
+    var inputErr *InputError
+    if errors.As(err, &inputErr) {
+        return inputErr.Param
+    }
+    return ""
+}
+
+// 原始 SSML 片段中不允许出现的元素，它们会破坏外层模板
+var forbiddenFragmentElements = map[string]bool{
+    "speak": true,
+    "voice": true,
+}
+
+// EscapeSSMLText 转义文本中的 XML 特殊字符
+func EscapeSSMLText(text string) string {
+    var buf bytes.Buffer
+    xml.EscapeText(&buf, []byte(text))
+    return buf.String()
+}
+
+// ValidateText 检查文本能否安全地放入 XML
+func ValidateText(text string) error {
+    if !utf8.ValidString(text) {
+        return &InputError{Param: "text", Message: "text is not valid UTF-8"}
+    }
+    for i, r := range text {
+        if !isXMLChar(r) {
+            return &InputError{Param: "text", Message: fmt.Sprintf("illegal character %U at offset %d", r, i)}
+        }
+    }
+    return nil
+}
+
+// ValidateSSMLFragment 检查原始 SSML 片段是否格式正确且不包含 speak/voice 元素
+func ValidateSSMLFragment(fragment string) error {
+    if err := ValidateText(fragment); err != nil {
+        return err
+    }
+
+    wrapped := `<prosody xmlns="http://www.w3.org/2001/10/synthesis" xmlns:mstts="http://www.w3.org/2001/mstts">` + fragment + `</prosody>`
+    decoder := xml.NewDecoder(strings.NewReader(wrapped))
+    decoder.Strict = true
+
+    depth := 0
+    closed := false
+    for {
+        tok, err := decoder.Token()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return &InputError{Param: "text", Message: "malformed ssml: " + err.Error()}
+        }
+        // 外层 prosody 提前闭合说明片段中有多余的结束标签，之后的内容会逃出模板
+        if closed {
+            return &InputError{Param: "text", Message: "unbalanced end tag in ssml fragment"}
+        }
+        switch t := tok.(type) {
+        case xml.StartElement:
+            depth++
+            if depth > 1 && forbiddenFragmentElements[t.Name.Local] {
+                return &InputError{Param: "text", Message: fmt.Sprintf("element <%s> is not allowed in ssml fragment", t.Name.Local)}
+            }
+        case xml.EndElement:
+            depth--
+            closed = depth == 0
+        case xml.ProcInst, xml.Directive:
+            return &InputError{Param: "text", Message: "processing instructions and directives are not allowed"}
+        }
+    }
+    return nil
+}
+
+// validatePercent 检查语速、语调等百分比参数是否为数字
+func validatePercent(param, value string) error {
+    if _, err := strconv.ParseFloat(value, 64); err != nil {
+        return &InputError{Param: param, Message: fmt.Sprintf("%q is not a number", value)}
+    }
+    return nil
+}
+
+func isXMLChar(r rune) bool {
+    return r == 0x09 || r == 0x0A || r == 0x0D ||
+        (r >= 0x20 && r <= 0xD7FF) ||
+        (r >= 0xE000 && r <= 0xFFFD) ||
+        (r >= 0x10000 && r <= 0x10FFFF)
+}
+
+// escapeAttr 转义 XML 属性值
+func escapeAttr(value string) string {
+    return EscapeSSMLText(value)
+}
+
+// validateSpeechOptions 检查文本和各个参数能否生成合法的 SSML，RawSSML 为 true 时文本按 SSML 片段检查，
+// 调用方需已填充默认值
+func validateSpeechOptions(opts SpeechOptions) error {
+    if opts.RawSSML {
+        if err := ValidateSSMLFragment(opts.Text); err != nil {
+            return err
+        }
+    } else if err := ValidateText(opts.Text); err != nil {
+        return err
+    }
+
+    if err := ValidateText(opts.VoiceName); err != nil {
+        return &InputError{Param: "voice", Message: "voice name contains illegal characters"}
+    }
+    if err := validatePercent("rate", opts.Rate); err != nil {
+        return err
+    }
+    if err := validatePercent("pitch", opts.Pitch); err != nil {
+        return err
+    }
+    if err := validateStyleDegree(opts.StyleDegree); err != nil {
+        return err
+    }
+    if err := validateVolume(opts.Volume); err != nil {
+        return err
+    }
+    if err := validateLang(opts.Lang); err != nil {
+        return err
+    }
+    if err := ValidateText(opts.Style + opts.Role); err != nil {
+        return &InputError{Param: "style", Message: "style or role contains illegal characters"}
+    }
+    return nil
+}
+
+// BuildSsml 校验参数并生成 SSML，RawSSML 为 true 时文本作为 SSML 片段原样嵌入
+func BuildSsml(opts SpeechOptions) (string, error) {
+    opts.applyDefaults()
+    if err := validateSpeechOptions(opts); err != nil {
+        return "", err
+    }
+
+    content := opts.Text
+    if !opts.RawSSML {
+        content = EscapeSSMLText(content)
+    }
+    return ssmlTemplate(content, opts), nil
+}
+
+// GetSsml 生成 SSML 格式的文本，text 会被转义
+func GetSsml(text, voiceName, rate, pitch string) string {
+    opts := SpeechOptions{VoiceName: voiceName, Rate: rate, Pitch: pitch}
+    opts.applyDefaults()
+    return ssmlTemplate(EscapeSSMLText(text), opts)
+}
+
+func ssmlTemplate(content string, opts SpeechOptions) string {
+    speakLang, contentLang := ssmlLangs(opts)
+    if contentLang != "" {
+        content = fmt.Sprintf(`<lang xml:lang="%s">%s</lang>`, escapeAttr(contentLang), content)
+    }
+
+    return fmt.Sprintf(`
+   <speak xmlns="http://www.w3.org/2001/10/synthesis" xmlns:mstts="http://www.w3.org/2001/mstts" version="1.0" xml:lang="%s">
+     <voice name="%s">
+       <mstts:express-as style="%s" styledegree="%s" role="%s">
+         <prosody rate="%s%%" pitch="%s%%" volume="%s">%s</prosody>
+       </mstts:express-as>
+     </voice>
+   </speak>
+ `, escapeAttr(speakLang), escapeAttr(opts.VoiceName), escapeAttr(opts.Style), escapeAttr(opts.StyleDegree), escapeAttr(opts.Role),
+        escapeAttr(opts.Rate), escapeAttr(opts.Pitch), escapeAttr(opts.Volume), content)
+}
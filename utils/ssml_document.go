@@ -0,0 +1,222 @@
+package utils
+
+import (
+    "context"
+    "encoding/xml"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+)
+
+const (
+    ssmlNamespace  = "http://www.w3.org/2001/10/synthesis"
+    msttsNamespace = "http://www.w3.org/2001/mstts"
+)
+
+// 支持的 SSML 元素
+var ssmlElements = map[string]bool{
+    "speak":    true,
+    "voice":    true,
+    "prosody":  true,
+    "break":    true,
+    "say-as":   true,
+    "phoneme":  true,
+    "emphasis": true,
+    "sub":      true,
+    "lang":     true,
+    "p":        true,
+    "s":        true,
+    "audio":    true,
+    "bookmark": true,
+    "lexicon":  true,
+}
+
+// 支持的 mstts 扩展元素
+var msttsElements = map[string]bool{
+    "express-as":      true,
+    "silence":         true,
+    "viseme":          true,
+    "audioduration":   true,
+    "backgroundaudio": true,
+}
+
+// DefaultVoiceName 返回默认语音，可通过 DEFAULT_VOICE 环境变量配置
+func DefaultVoiceName() string {
+    if voice := os.Getenv("DEFAULT_VOICE"); voice != "" {
+        return voice
+    }
+    return defaultVoiceName
+}
+
+// PrepareSsmlDocument 校验调用方提供的完整 SSML 文档，没有 voice 元素时使用默认语音包裹正文
+func PrepareSsmlDocument(doc string) (string, error) {
+    if err := ValidateText(doc); err != nil {
+        return "", &InputError{Param: "ssml", Message: "document contains illegal characters"}
+    }
+
+    decoder := xml.NewDecoder(strings.NewReader(doc))
+    decoder.Strict = true
+
+    var (
+        depth      int
+        voiceCount int
+        rootSeen   bool
+        looseText  bool
+        innerStart int64
+        innerEnd   int64
+        stack      []string
+    )
+
+    for {
+        offset := decoder.InputOffset()
+        tok, err := decoder.Token()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return "", &InputError{Param: "ssml", Message: "malformed ssml: " + err.Error()}
+        }
+
+        switch t := tok.(type) {
+        case xml.StartElement:
+            if depth == 0 {
+                if rootSeen {
+                    return "", &InputError{Param: "ssml", Message: "document must have a single <speak> root"}
+                }
+                if t.Name.Local != "speak" || t.Name.Space != ssmlNamespace {
+                    return "", &InputError{Param: "ssml", Message: fmt.Sprintf("root element must be <speak xmlns=%q>", ssmlNamespace)}
+                }
+                rootSeen = true
+                innerStart = decoder.InputOffset()
+            } else if err := checkSsmlElement(t, stack); err != nil {
+                return "", err
+            }
+            if t.Name.Local == "voice" && t.Name.Space == ssmlNamespace {
+                voiceCount++
+            }
+            stack = append(stack, t.Name.Local)
+            depth++
+        case xml.EndElement:
+            depth--
+            stack = stack[:len(stack)-1]
+            if depth == 0 {
+                innerEnd = offset
+            }
+        case xml.CharData:
+            if depth == 1 && strings.TrimSpace(string(t)) != "" {
+                looseText = true
+            }
+            if depth == 0 && strings.TrimSpace(string(t)) != "" {
+                return "", &InputError{Param: "ssml", Message: "text outside of <speak> is not allowed"}
+            }
+        case xml.Directive:
+            return "", &InputError{Param: "ssml", Message: "directives are not allowed"}
+        }
+    }
+
+    if !rootSeen {
+        return "", &InputError{Param: "ssml", Message: "document is empty"}
+    }
+    if innerEnd <= innerStart {
+        return "", &InputError{Param: "ssml", Message: "<speak> has no content"}
+    }
+    if voiceCount > 0 {
+        // 已指定语音时，speak 下除了空白之外的文本必须放在 voice 中
+        if looseText {
+            return "", &InputError{Param: "ssml", Message: "text outside of <voice> is not allowed"}
+        }
+        return doc, nil
+    }
+
+    // 没有指定语音时，将 speak 的正文放入默认语音中
+    return doc[:innerStart] +
+        fmt.Sprintf(`<voice name="%s">`, escapeAttr(DefaultVoiceName())) +
+        doc[innerStart:innerEnd] +
+        "</voice>" +
+        doc[innerEnd:], nil
+}
+
+// checkSsmlElement 检查元素是否在支持的集合中
+func checkSsmlElement(el xml.StartElement, stack []string) error {
+    switch el.Name.Space {
+    case ssmlNamespace:
+        if !ssmlElements[el.Name.Local] || el.Name.Local == "speak" {
+            return &InputError{Param: "ssml", Message: fmt.Sprintf("element <%s> is not supported", el.Name.Local)}
+        }
+    case msttsNamespace:
+        if !msttsElements[el.Name.Local] {
+            return &InputError{Param: "ssml", Message: fmt.Sprintf("element <mstts:%s> is not supported", el.Name.Local)}
+        }
+    default:
+        return &InputError{Param: "ssml", Message: fmt.Sprintf("element <%s> has unknown namespace %q", el.Name.Local, el.Name.Space)}
+    }
+
+    if el.Name.Local == "voice" && el.Name.Space == ssmlNamespace {
+        for _, parent := range stack {
+            if parent == "voice" {
+                return &InputError{Param: "ssml", Message: "<voice> elements cannot be nested"}
+            }
+        }
+        if ssmlAttr(el, "name") == "" {
+            return &InputError{Param: "ssml", Message: "<voice> requires a name attribute"}
+        }
+    }
+    return nil
+}
+
+func ssmlAttr(el xml.StartElement, name string) string {
+    for _, attr := range el.Attr {
+        if attr.Name.Local == name {
+            return attr.Value
+        }
+    }
+    return ""
+}
+
+// InspectSsmlDocument 校验 SSML 文档，返回其中使用的语音和正文的字符数
+func InspectSsmlDocument(doc string) ([]string, int, error) {
+    ssml, err := PrepareSsmlDocument(doc)
+    if err != nil {
+        return nil, 0, err
+    }
+
+    var voices []string
+    chars := 0
+    decoder := xml.NewDecoder(strings.NewReader(ssml))
+    for {
+        tok, err := decoder.Token()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, 0, &InputError{Param: "ssml", Message: "malformed ssml: " + err.Error()}
+        }
+        switch t := tok.(type) {
+        case xml.StartElement:
+            if t.Name.Local == "voice" && t.Name.Space == ssmlNamespace {
+                voices = append(voices, ssmlAttr(t, "name"))
+            }
+        case xml.CharData:
+            chars += len([]rune(strings.TrimSpace(string(t))))
+        }
+    }
+    return voices, chars, nil
+}
+
+// SynthesizeSsmlDocumentStream 校验完整的 SSML 文档后合成语音
+func SynthesizeSsmlDocumentStream(ctx context.Context, doc, outputFormat string) (io.ReadCloser, error) {
+    if outputFormat == "" {
+        outputFormat = defaultOutputFormat
+    }
+    if !IsSupportedOutputFormat(outputFormat) {
+        return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, outputFormat)
+    }
+
+    ssml, err := PrepareSsmlDocument(doc)
+    if err != nil {
+        return nil, err
+    }
+
+    return SynthesizeSsmlStream(ctx, ssml, outputFormat)
+}
@@ -0,0 +1,234 @@
+package utils
+
+import (
+    "encoding/xml"
+    "errors"
+    "io"
+    "strings"
+    "testing"
+)
+
+// adversarialTexts 普通模式下必须原样朗读的文本
+var adversarialTexts = []string{
+    "a < b && c > d",
+    "Tom & Jerry",
+    `she said "hi" and 'bye'`,
+    `</prosody></mstts:express-as></voice><voice name="en-US-GuyNeural">injected`,
+    `</voice></speak><speak>injected</speak>`,
+    `<?xml-stylesheet href="x"?>`,
+    `<!DOCTYPE speak [<!ENTITY x "boom">]>&x;`,
+    "<![CDATA[ raw ]]>",
+    "tab\tnewline\ncarriage\r",
+    "中文，日本語、한국어 😀",
+}
+
+// ssmlElement 解析 SSML 中的元素和文本，用于断言结构没有被注入
+type ssmlElement struct {
+    voices []string
+    speaks int
+    text   string
+}
+
+func parseSsml(t *testing.T, ssml string) ssmlElement {
+    t.Helper()
+    decoder := xml.NewDecoder(strings.NewReader(ssml))
+    decoder.Strict = true
+
+    var result ssmlElement
+    var text strings.Builder
+    inProsody := false
+    for {
+        tok, err := decoder.Token()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            t.Fatalf("generated ssml is not well-formed: %v\n%s", err, ssml)
+        }
+        switch tok := tok.(type) {
+        case xml.StartElement:
+            switch tok.Name.Local {
+            case "speak":
+                result.speaks++
+            case "voice":
+                for _, attr := range tok.Attr {
+                    if attr.Name.Local == "name" {
+                        result.voices = append(result.voices, attr.Value)
+                    }
+                }
+            case "prosody":
+                inProsody = true
+            }
+        case xml.EndElement:
+            if tok.Name.Local == "prosody" {
+                inProsody = false
+            }
+        case xml.CharData:
+            if inProsody {
+                text.Write(tok)
+            }
+        case xml.ProcInst, xml.Directive:
+            t.Fatalf("generated ssml contains %T\n%s", tok, ssml)
+        }
+    }
+    result.text = text.String()
+    return result
+}
+
+func TestEscapeSSMLText(t *testing.T) {
+    tests := map[string]string{
+        "a < b":       "a &lt; b",
+        "a > b":       "a &gt; b",
+        "Tom & Jerry": "Tom &amp; Jerry",
+        `"quoted"`:    "&#34;quoted&#34;",
+        "it's":        "it&#39;s",
+        "<voice>":     "&lt;voice&gt;",
+        "plain text":  "plain text",
+    }
+    for input, want := range tests {
+        if got := EscapeSSMLText(input); got != want {
+            t.Errorf("EscapeSSMLText(%q) = %q, want %q", input, got, want)
+        }
+    }
+}
+
+func TestValidateText(t *testing.T) {
+    for _, text := range adversarialTexts {
+        if err := ValidateText(text); err != nil {
+            t.Errorf("ValidateText(%q) = %v, want nil", text, err)
+        }
+    }
+
+    invalid := []string{
+        "null \x00 byte",
+        "escape \x1b[31m",
+        "bell \a",
+        "form feed \f",
+        "noncharacter \uFFFE",
+        "invalid utf-8 \xff\xfe",
+        "truncated \xe4\xb8",
+    }
+    for _, text := range invalid {
+        err := ValidateText(text)
+        if !errors.Is(err, ErrInvalidInput) {
+            t.Errorf("ValidateText(%q) = %v, want ErrInvalidInput", text, err)
+            continue
+        }
+        if param := InvalidParam(err); param != "text" {
+            t.Errorf("ValidateText(%q) param = %q, want text", text, param)
+        }
+    }
+}
+
+func TestValidateSSMLFragment(t *testing.T) {
+    valid := []string{
+        "plain text",
+        `Hello <break time="500ms"/> world`,
+        `<emphasis level="strong">loud</emphasis> and <say-as interpret-as="characters">SSML</say-as>`,
+        `<mstts:silence type="Sentenceboundary" value="200ms"/>`,
+        `<prosody rate="+20%">nested prosody</prosody>`,
+        "Tom &amp; Jerry",
+    }
+    for _, fragment := range valid {
+        if err := ValidateSSMLFragment(fragment); err != nil {
+            t.Errorf("ValidateSSMLFragment(%q) = %v, want nil", fragment, err)
+        }
+    }
+
+    invalid := []string{
+        `<voice name="en-US-GuyNeural">injected</voice>`,
+        `<speak>injected</speak>`,
+        `</prosody><voice name="x">escape</voice><prosody>`,
+        `<?xml-stylesheet href="x"?>`,
+        `<!DOCTYPE speak [<!ENTITY x "boom">]>`,
+        "Tom & Jerry",
+        "a < b",
+        "<break>",
+        "</prosody>",
+        "null \x00 byte",
+        "invalid utf-8 \xff",
+    }
+    for _, fragment := range invalid {
+        if err := ValidateSSMLFragment(fragment); !errors.Is(err, ErrInvalidInput) {
+            t.Errorf("ValidateSSMLFragment(%q) = %v, want ErrInvalidInput", fragment, err)
+        }
+    }
+}
+
+func TestBuildSsmlEscapesText(t *testing.T) {
+    for _, text := range adversarialTexts {
+        ssml, err := BuildSsml(SpeechOptions{Text: text, VoiceName: "en-US-JennyNeural"})
+        if err != nil {
+            t.Errorf("BuildSsml(%q) = %v", text, err)
+            continue
+        }
+        doc := parseSsml(t, ssml)
+        if doc.speaks != 1 || len(doc.voices) != 1 || doc.voices[0] != "en-US-JennyNeural" {
+            t.Errorf("BuildSsml(%q) changed the document structure: %d speak, voices %v", text, doc.speaks, doc.voices)
+        }
+        if doc.text != text {
+            t.Errorf("BuildSsml(%q) text = %q, want the original text", text, doc.text)
+        }
+    }
+}
+
+func TestBuildSsmlEscapesAttributes(t *testing.T) {
+    ssml, err := BuildSsml(SpeechOptions{
+        Text:      "hello",
+        VoiceName: `en-US-JennyNeural"><voice name="injected`,
+        Style:     `cheerful" role="x`,
+    })
+    if err != nil {
+        t.Fatalf("BuildSsml = %v", err)
+    }
+    doc := parseSsml(t, ssml)
+    if len(doc.voices) != 1 || doc.voices[0] != `en-US-JennyNeural"><voice name="injected` {
+        t.Errorf("voice attribute was not escaped: %v", doc.voices)
+    }
+}
+
+func TestBuildSsmlRawMode(t *testing.T) {
+    ssml, err := BuildSsml(SpeechOptions{Text: `Hello <break time="500ms"/> world`, RawSSML: true})
+    if err != nil {
+        t.Fatalf("BuildSsml raw = %v", err)
+    }
+    if !strings.Contains(ssml, `<break time="500ms"/>`) {
+        t.Errorf("raw fragment was not embedded as-is:\n%s", ssml)
+    }
+    parseSsml(t, ssml)
+
+    for _, fragment := range []string{
+        `<voice name="en-US-GuyNeural">injected</voice>`,
+        `</prosody></mstts:express-as></voice></speak><speak>`,
+        `<!DOCTYPE speak>`,
+    } {
+        if _, err := BuildSsml(SpeechOptions{Text: fragment, RawSSML: true}); !errors.Is(err, ErrInvalidInput) {
+            t.Errorf("BuildSsml raw %q = %v, want ErrInvalidInput", fragment, err)
+        }
+    }
+}
+
+func TestBuildSsmlRejectsInvalidInput(t *testing.T) {
+    tests := []struct {
+        name  string
+        opts  SpeechOptions
+        param string
+    }{
+        {"control character", SpeechOptions{Text: "a\x00b"}, "text"},
+        {"invalid utf-8", SpeechOptions{Text: "a\xffb"}, "text"},
+        {"control character in voice", SpeechOptions{Text: "a", VoiceName: "x\x01"}, "voice"},
+        {"rate is not a number", SpeechOptions{Text: "a", Rate: `10" pitch="50`}, "rate"},
+        {"pitch is not a number", SpeechOptions{Text: "a", Pitch: "high"}, "pitch"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, err := BuildSsml(tt.opts)
+            if !errors.Is(err, ErrInvalidInput) {
+                t.Fatalf("BuildSsml = %v, want ErrInvalidInput", err)
+            }
+            if param := InvalidParam(err); param != tt.param {
+                t.Errorf("param = %q, want %q", param, tt.param)
+            }
+        })
+    }
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+    "context"
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// 音量可用的关键字
+var volumeKeywords = map[string]bool{
+    "silent":  true,
+    "x-soft":  true,
+    "soft":    true,
+    "medium":  true,
+    "loud":    true,
+    "x-loud":  true,
+    "default": true,
+}
+
+// validateStyleDegree 检查风格强度，取值范围为 0.01 到 2
+func validateStyleDegree(value string) error {
+    degree, err := strconv.ParseFloat(value, 64)
+    if err != nil || degree < 0.01 || degree > 2 {
+        return &InputError{Param: "styledegree", Message: fmt.Sprintf("%q must be a number between 0.01 and 2", value)}
+    }
+    return nil
+}
+
+// validateVolume 检查音量，取值为 0 到 100 的数字或关键字
+func validateVolume(value string) error {
+    if volumeKeywords[value] {
+        return nil
+    }
+    volume, err := strconv.ParseFloat(value, 64)
+    if err != nil || volume < 0 || volume > 100 {
+        return &InputError{Param: "volume", Message: fmt.Sprintf("%q must be a number between 0 and 100 or one of silent, x-soft, soft, medium, loud, x-loud, default", value)}
+    }
+    return nil
+}
+
+// ValidateVoiceCapabilities 根据语音列表检查所选语音是否支持请求的风格和角色
+func ValidateVoiceCapabilities(ctx context.Context, opts SpeechOptions) error {
+    opts.applyDefaults()
+    if opts.Style == defaultStyle && opts.Role == defaultRole {
+        return nil
+    }
+
+    voices, err := VoiceListContext(ctx)
+    if err != nil {
+        // 语音列表不可用时不阻塞合成，交由上游处理
+        log.Warnf("Skipping style validation, voice list unavailable: %v", err)
+        return nil
+    }
+
+    voice, ok := FindVoice(voices, opts.VoiceName)
+    if !ok {
+        return &InputError{Param: "voice", Message: fmt.Sprintf("unknown voice %q", opts.VoiceName)}
+    }
+
+    if opts.Style != defaultStyle && !voice.SupportsStyle(opts.Style) {
+        return &InputError{Param: "style", Message: fmt.Sprintf("voice %s does not support style %q, supported: %s", opts.VoiceName, opts.Style, supportedList(voice.StyleList))}
+    }
+    if opts.Role != defaultRole && !voice.SupportsRole(opts.Role) {
+        return &InputError{Param: "role", Message: fmt.Sprintf("voice %s does not support role %q, supported: %s", opts.VoiceName, opts.Role, supportedList(voice.RolePlayList))}
+    }
+    return nil
+}
+
+func supportedList(list []string) string {
+    if len(list) == 0 {
+        return "none"
+    }
+    return strings.Join(list, ", ")
+}
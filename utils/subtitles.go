@@ -0,0 +1,178 @@
+package utils
+
+import (
+    "fmt"
+    "strings"
+    "time"
+    "unicode"
+    "unicode/utf8"
+)
+
+// 字幕格式
+const (
+    SubtitleSRT  = "srt"
+    SubtitleVTT  = "vtt"
+    SubtitleJSON = "json"
+)
+
+// defaultMaxLineChars 每行字幕的默认最大字符数
+const defaultMaxLineChars = 40
+
+// SubtitleCue 一条字幕
+type SubtitleCue struct {
+    Index int           `json:"index"`
+    Start time.Duration `json:"-"`
+    End   time.Duration `json:"-"`
+    Text  string        `json:"text"`
+}
+
+// WordTiming 单词的时间信息，单位为毫秒
+type WordTiming struct {
+    Text  string `json:"text"`
+    Start int64  `json:"start"`
+    End   int64  `json:"end"`
+    // Punctuation 为 true 时表示标点
+    Punctuation bool `json:"punctuation,omitempty"`
+}
+
+// 字幕换行的标点，句末标点和句内停顿都会结束当前行
+var subtitleBreaks = map[rune]bool{
+    '。': true, '！': true, '？': true, '；': true, '，': true, '、': true, '：': true, '…': true,
+    '.': true, '!': true, '?': true, ';': true, ',': true, ':': true,
+}
+
+// IsSubtitleFormat 判断字幕格式是否支持
+func IsSubtitleFormat(format string) bool {
+    switch format {
+    case SubtitleSRT, SubtitleVTT, SubtitleJSON:
+        return true
+    default:
+        return false
+    }
+}
+
+// WordTimings 从元数据事件中提取单词和标点的时间
+func WordTimings(events []SynthesisEvent) []WordTiming {
+    words := make([]WordTiming, 0, len(events))
+    for _, event := range events {
+        if event.Type != EventWordBoundary || event.Text == "" {
+            continue
+        }
+        words = append(words, WordTiming{
+            Text:        event.Text,
+            Start:       event.Offset.Milliseconds(),
+            End:         (event.Offset + event.Duration).Milliseconds(),
+            Punctuation: event.BoundaryType == "PunctuationBoundary",
+        })
+    }
+    return words
+}
+
+// BuildSubtitleCues 按标点和每行最大字符数将单词分组为字幕
+func BuildSubtitleCues(events []SynthesisEvent, maxLineChars int) []SubtitleCue {
+    if maxLineChars <= 0 {
+        maxLineChars = defaultMaxLineChars
+    }
+
+    var cues []SubtitleCue
+    var line strings.Builder
+    var start, end time.Duration
+    var previous string
+
+    flush := func() {
+        text := strings.TrimSpace(line.String())
+        if text != "" {
+            cues = append(cues, SubtitleCue{Index: len(cues) + 1, Start: start, End: end, Text: text})
+        }
+        line.Reset()
+        previous = ""
+    }
+
+    for _, event := range events {
+        if event.Type != EventWordBoundary || event.Text == "" {
+            continue
+        }
+        word := event.Text
+        isBreak := isSubtitleBreak(word)
+
+        // 加上当前单词会超长时先换行，标点总是跟在前一个单词后面
+        if !isBreak && line.Len() > 0 && utf8.RuneCountInString(line.String())+utf8.RuneCountInString(word)+1 > maxLineChars {
+            flush()
+        }
+        if line.Len() == 0 {
+            if isBreak {
+                // 行首的标点附加到上一条字幕
+                if len(cues) > 0 {
+                    cues[len(cues)-1].Text += word
+                    cues[len(cues)-1].End = event.Offset + event.Duration
+                }
+                continue
+            }
+            start = event.Offset
+        }
+        if needsSpace(previous, word) {
+            line.WriteByte(' ')
+        }
+        line.WriteString(word)
+        previous = word
+        if wordEnd := event.Offset + event.Duration; wordEnd > end {
+            end = wordEnd
+        }
+
+        if isBreak {
+            flush()
+        }
+    }
+    flush()
+
+    return cues
+}
+
+func isSubtitleBreak(word string) bool {
+    r, _ := utf8.DecodeLastRuneInString(word)
+    return utf8.RuneCountInString(word) <= 2 && subtitleBreaks[r]
+}
+
+// needsSpace 判断两个单词之间是否需要空格，中日韩文字之间不加空格
+func needsSpace(previous, word string) bool {
+    if previous == "" {
+        return false
+    }
+    last, _ := utf8.DecodeLastRuneInString(previous)
+    first, _ := utf8.DecodeRuneInString(word)
+    if isCJK(last) || isCJK(first) {
+        return false
+    }
+    return !unicode.IsPunct(first)
+}
+
+func isCJK(r rune) bool {
+    return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+        unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) ||
+        (r >= 0x3000 && r <= 0x303F) || (r >= 0xFF00 && r <= 0xFFEF)
+}
+
+// FormatSRT 输出 SRT 字幕
+func FormatSRT(cues []SubtitleCue) string {
+    var b strings.Builder
+    for _, cue := range cues {
+        fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", cue.Index, subtitleTimestamp(cue.Start, ","), subtitleTimestamp(cue.End, ","), cue.Text)
+    }
+    return b.String()
+}
+
+// FormatWebVTT 输出 WebVTT 字幕
+func FormatWebVTT(cues []SubtitleCue) string {
+    var b strings.Builder
+    b.WriteString("WEBVTT\n\n")
+    for _, cue := range cues {
+        fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", cue.Index, subtitleTimestamp(cue.Start, "."), subtitleTimestamp(cue.End, "."), cue.Text)
+    }
+    return b.String()
+}
+
+// subtitleTimestamp 格式化为 hh:mm:ss,mmm (SRT) 或 hh:mm:ss.mmm (WebVTT)
+func subtitleTimestamp(d time.Duration, separator string) string {
+    ms := d.Milliseconds()
+    return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, separator, ms%1000)
+}
@@ -0,0 +1,243 @@
+package utils
+
+import (
+    "context"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    // 距离过期不足该时间时在后台刷新 token
+    tokenRefreshAhead = 5 * time.Minute
+    // 距离过期不足该时间时视为已失效，必须同步刷新
+    tokenExpiryMargin = 30 * time.Second
+    // 刷新失败后至少等待该时间再重试，避免每个请求都去请求上游
+    tokenRetryBackoff = 10 * time.Second
+)
+
+var (
+    errTokenMissing  = errors.New("invalid or missing 't' in endpoint")
+    errRegionMissing = errors.New("invalid or missing 'r' in endpoint")
+)
+
+// EndpointToken 语音合成服务的授权信息
+type EndpointToken struct {
+    Region    string
+    Token     string
+    ExpiresAt time.Time
+}
+
+// TokenState 用于诊断输出的 token 状态
+type TokenState struct {
+    Region     string    `json:"region"`
+    ExpiresAt  time.Time `json:"expires_at"`
+    ExpiresIn  int64     `json:"expires_in"`
+    Refreshing bool      `json:"refreshing"`
+    LastError  string    `json:"last_error,omitempty"`
+}
+
+// TokenManager 缓存端点 token，直到 JWT 过期前才重新获取
+type TokenManager struct {
+    mu       sync.Mutex
+    current  *EndpointToken
+    inflight chan struct{}
+    lastErr  error
+    failedAt time.Time
+    fetch    func(ctx context.Context) (map[string]interface{}, error)
+}
+
+var tokenManager = NewTokenManager(GetEndpointContext)
+
+// NewTokenManager 创建 token 管理器，fetch 用于获取新的端点信息
+func NewTokenManager(fetch func(ctx context.Context) (map[string]interface{}, error)) *TokenManager {
+    return &TokenManager{fetch: fetch}
+}
+
+// Get 返回可用的 token，快过期时在后台刷新，已过期时同步刷新
+func (m *TokenManager) Get() (*EndpointToken, error) {
+    return m.GetContext(context.Background())
+}
+
+// GetContext 与 Get 相同，但 ctx 结束时不再等待刷新结果
+func (m *TokenManager) GetContext(ctx context.Context) (*EndpointToken, error) {
+    m.mu.Lock()
+    current := m.current
+    now := time.Now()
+
+    if current != nil && now.Before(current.ExpiresAt.Add(-tokenExpiryMargin)) {
+        if now.After(current.ExpiresAt.Add(-tokenRefreshAhead)) && m.canRetryLocked(now) {
+            m.startRefreshLocked()
+        }
+        m.mu.Unlock()
+        return current, nil
+    }
+
+    // 刚刚刷新失败时直接返回上次的错误
+    if m.inflight == nil && m.lastErr != nil && !m.canRetryLocked(now) {
+        err := m.lastErr
+        m.mu.Unlock()
+        return nil, err
+    }
+
+    done := m.startRefreshLocked()
+    m.mu.Unlock()
+
+    // 刷新由所有等待者共享，单个调用方放弃不会中断它
+    select {
+    case <-done:
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    }
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if m.current != nil && time.Now().Before(m.current.ExpiresAt.Add(-tokenExpiryMargin)) {
+        return m.current, nil
+    }
+    if m.lastErr != nil {
+        return nil, m.lastErr
+    }
+    return nil, errEndpoint
+}
+
+// Invalidate 丢弃当前 token，例如上游返回 401 时
+func (m *TokenManager) Invalidate() {
+    m.mu.Lock()
+    m.current = nil
+    m.mu.Unlock()
+}
+
+// Reset 丢弃当前 token 和上次刷新失败的记录，下次调用立即重新获取
+func (m *TokenManager) Reset() {
+    m.mu.Lock()
+    m.current = nil
+    m.lastErr = nil
+    m.failedAt = time.Time{}
+    m.mu.Unlock()
+}
+
+// canRetryLocked 判断距离上次刷新失败是否已超过退避时间，调用方需持有锁
+func (m *TokenManager) canRetryLocked(now time.Time) bool {
+    return m.failedAt.IsZero() || now.Sub(m.failedAt) >= tokenRetryBackoff
+}
+
+// State 返回当前 token 的状态
+func (m *TokenManager) State() TokenState {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+
+    state := TokenState{Refreshing: m.inflight != nil}
+    if m.current != nil {
+        state.Region = m.current.Region
+        state.ExpiresAt = m.current.ExpiresAt
+        state.ExpiresIn = int64(time.Until(m.current.ExpiresAt).Seconds())
+        if state.ExpiresIn < 0 {
+            state.ExpiresIn = 0
+        }
+    }
+    if m.lastErr != nil {
+        state.LastError = m.lastErr.Error()
+    }
+    return state
+}
+
+// startRefreshLocked 启动一次刷新，已有刷新在进行时复用它，调用方需持有锁
+func (m *TokenManager) startRefreshLocked() chan struct{} {
+    if m.inflight != nil {
+        return m.inflight
+    }
+    done := make(chan struct{})
+    m.inflight = done
+
+    go func() {
+        token, err := m.refresh()
+
+        m.mu.Lock()
+        if err != nil {
+            log.Errorf("failed to refresh endpoint token: %v", err)
+            m.lastErr = err
+            m.failedAt = time.Now()
+        } else {
+            log.Infof("endpoint token refreshed, region: %s, expires in: %s", token.Region, time.Until(token.ExpiresAt).Round(time.Second))
+            m.current = token
+            m.lastErr = nil
+            m.failedAt = time.Time{}
+        }
+        m.inflight = nil
+        m.mu.Unlock()
+
+        close(done)
+    }()
+
+    return done
+}
+
+func (m *TokenManager) refresh() (*EndpointToken, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+    defer cancel()
+
+    endpoint, err := m.fetch(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    r, ok := endpoint["r"].(string)
+    if !ok || r == "" {
+        return nil, errRegionMissing
+    }
+    t, ok := endpoint["t"].(string)
+    if !ok || t == "" {
+        return nil, errTokenMissing
+    }
+
+    expiresAt, err := parseJWTExpiry(t)
+    if err != nil {
+        return nil, err
+    }
+
+    return &EndpointToken{Region: r, Token: t, ExpiresAt: expiresAt}, nil
+}
+
+// parseJWTExpiry 解析 JWT 的 exp 字段
+func parseJWTExpiry(token string) (time.Time, error) {
+    parts := strings.Split(token, ".")
+    if len(parts) < 2 {
+        return time.Time{}, errors.New("malformed endpoint token")
+    }
+
+    payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+    if err != nil {
+        return time.Time{}, err
+    }
+
+    var claims struct {
+        Exp int64 `json:"exp"`
+    }
+    if err := json.Unmarshal(payload, &claims); err != nil {
+        return time.Time{}, err
+    }
+    if claims.Exp == 0 {
+        return time.Time{}, errors.New("endpoint token has no exp claim")
+    }
+
+    return time.Unix(claims.Exp, 0), nil
+}
+
+// GetToken 获取缓存的端点 token
+func GetToken() (*EndpointToken, error) {
+    return tokenManager.Get()
+}
+
+// GetTokenContext 获取缓存的端点 token，ctx 结束时不再等待
+func GetTokenContext(ctx context.Context) (*EndpointToken, error) {
+    return tokenManager.GetContext(ctx)
+}
+
+// GetTokenState 返回端点 token 的诊断信息
+func GetTokenState() TokenState {
+    return tokenManager.State()
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+    "os"
+    "strings"
+    "sync"
+)
+
+// UpstreamURLs 上游服务地址，{region} 会替换为 token 所属的区域
+type UpstreamURLs struct {
+    // Endpoint 翻译应用获取 token 的端点
+    Endpoint string
+    // Voices 翻译应用使用的语音列表
+    Voices string
+    // Speech 合成服务的根地址，REST、WebSocket 接口和 Azure 语音列表都基于它，http(s) 对应 ws(s)
+    Speech string
+    // AzureToken Azure 订阅密钥换取 token 的地址
+    AzureToken string
+}
+
+var (
+    upstreamMu   sync.RWMutex
+    upstreamURLs = DefaultUpstreamURLs()
+)
+
+// DefaultUpstreamURLs 返回微软官方服务的地址
+func DefaultUpstreamURLs() UpstreamURLs {
+    return UpstreamURLs{
+        Endpoint:   "https://dev.microsofttranslator.com/apps/endpoint?api-version=1.0",
+        Voices:     "https://eastus.api.speech.microsoft.com/cognitiveservices/voices/list",
+        Speech:     "https://{region}.tts.speech.microsoft.com",
+        AzureToken: "https://{region}.api.cognitive.microsoft.com/sts/v1.0/issueToken",
+    }
+}
+
+// loadUpstreamURLs 读取 UPSTREAM_* 环境变量，未设置的使用默认地址
+func loadUpstreamURLs() UpstreamURLs {
+    return UpstreamURLs{
+        Endpoint:   os.Getenv("UPSTREAM_ENDPOINT_URL"),
+        Voices:     os.Getenv("UPSTREAM_VOICES_URL"),
+        Speech:     os.Getenv("UPSTREAM_SPEECH_URL"),
+        AzureToken: os.Getenv("UPSTREAM_AZURE_TOKEN_URL"),
+    }.withDefaults()
+}
+
+func (u UpstreamURLs) withDefaults() UpstreamURLs {
+    defaults := DefaultUpstreamURLs()
+    if u.Endpoint == "" {
+        u.Endpoint = defaults.Endpoint
+    }
+    if u.Voices == "" {
+        u.Voices = defaults.Voices
+    }
+    if u.Speech == "" {
+        u.Speech = defaults.Speech
+    }
+    if u.AzureToken == "" {
+        u.AzureToken = defaults.AzureToken
+    }
+    u.Speech = strings.TrimRight(u.Speech, "/")
+    return u
+}
+
+// SetUpstreamURLs 替换上游地址，例如指向本地的模拟服务，空字段使用默认地址；
+// 已缓存的 token、语音列表和获取失败的记录属于旧地址，会被丢弃
+func SetUpstreamURLs(u UpstreamURLs) {
+    upstreamMu.Lock()
+    upstreamURLs = u.withDefaults()
+    upstreamMu.Unlock()
+
+    for _, p := range providers {
+        if sp, ok := p.(*speechProvider); ok {
+            sp.tokens.Reset()
+        }
+    }
+    voiceCache.Reset()
+}
+
+// GetUpstreamURLs 返回当前使用的上游地址
+func GetUpstreamURLs() UpstreamURLs {
+    upstreamMu.RLock()
+    defer upstreamMu.RUnlock()
+    return upstreamURLs
+}
+
+// regionURL 将地址模板中的 {region} 替换为区域
+func regionURL(template, region string) string {
+    return strings.ReplaceAll(template, "{region}", region)
+}
+
+// speechURL 合成服务下 path 的完整地址
+func speechURL(region, path string) string {
+    return regionURL(GetUpstreamURLs().Speech, region) + path
+}
+
+// speechWebsocketURL 合成服务下 path 的 WebSocket 地址
+func speechWebsocketURL(region, path string) string {
+    u := speechURL(region, path)
+    if rest, ok := strings.CutPrefix(u, "https://"); ok {
+        return "wss://" + rest
+    }
+    if rest, ok := strings.CutPrefix(u, "http://"); ok {
+        return "ws://" + rest
+    }
+    return u
+}
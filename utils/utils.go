@@ -2,6 +2,7 @@ package utils
 
 import (
     "bytes"
+    "context"
     "crypto/hmac"
     "crypto/sha256"
     "encoding/base64"
@@ -20,12 +21,33 @@ import (
 )
 
 var (
-    log            = logrus.New()
-    client         = &http.Client{}
-    voiceListCache []interface{}
-    cacheDuration  = getCacheDuration()
+    log           = logrus.New()
+    client        = newHTTPClient()
+    cacheDuration = 1 * time.Hour
 )
 
+// Init 从环境变量读取 utils 包的配置，需在加载 .env 之后、启动服务之前调用
+func Init() {
+    loadClientConfig()
+    loadChunkConfig()
+    voiceAliases = loadVoiceAliases(os.Getenv("VOICE_ALIASES_FILE"))
+    instructionRules = loadInstructionRules(os.Getenv("INSTRUCTION_RULES_FILE"))
+    synthesisBackend = os.Getenv("SYNTHESIS_BACKEND")
+    providers = loadProviders()
+    SetUpstreamURLs(loadUpstreamURLs())
+    audioCache = loadAudioCache()
+    loadRateLimiters()
+    loadTrustedProxies()
+    keyStore = NewKeyStore(keyStoreFilePath())
+    cacheDuration = getCacheDuration()
+    voiceCache = NewVoiceCache(fetchVoiceListWithRetry, cacheDuration, voiceCacheFilePath())
+}
+
+// SetLogLevel 设置 utils 包的日志级别，debug 级别会输出发送给上游的 SSML
+func SetLogLevel(level logrus.Level) {
+    log.SetLevel(level)
+}
+
 func getCacheDuration() time.Duration {
     durationStr := os.Getenv("CACHE_DURATION")
     if durationStr == "" {
@@ -38,18 +60,7 @@ func getCacheDuration() time.Duration {
     return duration
 }
 
-func init() {
-    ticker := time.NewTicker(cacheDuration)
-    go func() {
-        for range ticker.C {
-            voiceListCache = nil
-        }
-    }()
-}
-
 const (
-    endpointURL          = "https://dev.microsofttranslator.com/apps/endpoint?api-version=1.0"
-    voicesListURL        = "https://eastus.api.speech.microsoft.com/cognitiveservices/voices/list"
     userAgent            = "okhttp/4.5.0"
     clientVersion        = "4.0.530a 5fe1dc6c"
     userId               = "0f04d16a175c411e"
@@ -60,6 +71,10 @@ const (
     defaultRate          = "0"
     defaultPitch         = "0"
     defaultOutputFormat  = "audio-24khz-48kbitrate-mono-mp3"
+    defaultStyle         = "general"
+    defaultStyleDegree   = "1.0"
+    defaultRole          = "default"
+    defaultVolume        = "50"
 )
 
 var (
@@ -68,6 +83,12 @@ var (
 
 // GetEndpoint 获取语音合成服务的端点信息
 func GetEndpoint() (map[string]interface{}, error) {
+    return GetEndpointContext(context.Background())
+}
+
+// GetEndpointContext 获取语音合成服务的端点信息，ctx 结束时取消请求
+func GetEndpointContext(ctx context.Context) (map[string]interface{}, error) {
+    endpointURL := GetUpstreamURLs().Endpoint
     signature := Sign(endpointURL)
     headers := map[string]string{
         "Accept-Language":        "zh-Hans",
@@ -81,7 +102,7 @@ func GetEndpoint() (map[string]interface{}, error) {
         "Content-Length":         "0",
         "Accept-Encoding":        "gzip",
     }
-    req, err := http.NewRequest("POST", endpointURL, nil)
+    req, err := http.NewRequestWithContext(ctx, "POST", endpointURL, nil)
     if err != nil {
         return nil, err
     }
@@ -95,6 +116,9 @@ func GetEndpoint() (map[string]interface{}, error) {
         log.Error("failed to do request: ", err)
         return nil, err
     }
+    if err := checkResponse(resp); err != nil {
+        return nil, err
+    }
     defer resp.Body.Close()
 
     var result map[string]interface{}
@@ -122,41 +146,155 @@ func Sign(urlStr string) string {
     return fmt.Sprintf("MSTranslatorAndroidApp::%s::%s::%s", signBase64, formattedDate, uuidStr)
 }
 
-// GetVoice 获取语音合成结果
-func GetVoice(text, voiceName, rate, pitch, outputFormat string) ([]byte, error) {
-    if voiceName == "" {
-        voiceName = defaultVoiceName
+// SpeechOptions 语音合成参数
+type SpeechOptions struct {
+    Text         string
+    VoiceName    string
+    Rate         string
+    Pitch        string
+    OutputFormat string
+    Style        string
+    StyleDegree  string
+    Role         string
+    Volume       string
+    // Lang 指定正文语言，为空时使用语音自身的区域
+    Lang string
+    // RawSSML 为 true 时 Text 作为 SSML 片段嵌入，不做转义
+    RawSSML bool
+
+    // 由语音列表解析出的区域信息
+    locale       string
+    multilingual bool
+}
+
+func (o *SpeechOptions) applyDefaults() {
+    if o.VoiceName == "" {
+        o.VoiceName = DefaultVoiceName()
+    }
+    if o.Rate == "" {
+        o.Rate = defaultRate
+    }
+    if o.Pitch == "" {
+        o.Pitch = defaultPitch
+    }
+    if o.OutputFormat == "" {
+        o.OutputFormat = defaultOutputFormat
     }
-    if rate == "" {
-        rate = defaultRate
+    if o.Style == "" {
+        o.Style = defaultStyle
     }
-    if pitch == "" {
-        pitch = defaultPitch
+    if o.StyleDegree == "" {
+        o.StyleDegree = defaultStyleDegree
     }
-    if outputFormat == "" {
-        outputFormat = defaultOutputFormat
+    if o.Role == "" {
+        o.Role = defaultRole
     }
+    if o.Volume == "" {
+        o.Volume = defaultVolume
+    }
+}
+
+// GetVoice 获取语音合成结果
+func GetVoice(text, voiceName, rate, pitch, outputFormat string) ([]byte, error) {
+    return GetVoiceContext(context.Background(), text, voiceName, rate, pitch, outputFormat)
+}
+
+// GetVoiceContext 获取语音合成结果，ctx 结束时取消请求
+func GetVoiceContext(ctx context.Context, text, voiceName, rate, pitch, outputFormat string) ([]byte, error) {
+    return Synthesize(ctx, SpeechOptions{
+        Text:         text,
+        VoiceName:    voiceName,
+        Rate:         rate,
+        Pitch:        pitch,
+        OutputFormat: outputFormat,
+    })
+}
+
+// GetVoiceStream 获取语音合成结果的数据流，调用方负责关闭
+func GetVoiceStream(text, voiceName, rate, pitch, outputFormat string) (io.ReadCloser, error) {
+    return GetVoiceStreamContext(context.Background(), text, voiceName, rate, pitch, outputFormat)
+}
+
+// GetVoiceStreamContext 获取语音合成结果的数据流，ctx 结束时中断传输
+func GetVoiceStreamContext(ctx context.Context, text, voiceName, rate, pitch, outputFormat string) (io.ReadCloser, error) {
+    return SynthesizeStream(ctx, SpeechOptions{
+        Text:         text,
+        VoiceName:    voiceName,
+        Rate:         rate,
+        Pitch:        pitch,
+        OutputFormat: outputFormat,
+    })
+}
 
-    endpoint, err := GetEndpoint()
+// Synthesize 按参数合成语音并读取全部数据
+func Synthesize(ctx context.Context, opts SpeechOptions) ([]byte, error) {
+    body, err := SynthesizeStream(ctx, opts)
     if err != nil {
         return nil, err
     }
+    defer body.Close()
+
+    return io.ReadAll(body)
+}
 
-    r, ok := endpoint["r"].(string)
-    if !ok || r == "" {
-        return nil, errors.New("invalid or missing 'r' in endpoint")
+// SynthesizeStream 按参数合成语音，参数不合法时在请求上游之前返回 ErrInvalidInput
+func SynthesizeStream(ctx context.Context, opts SpeechOptions) (io.ReadCloser, error) {
+    opts, ssml, err := prepareSpeech(ctx, opts)
+    if err != nil {
+        return nil, err
     }
 
-    u := fmt.Sprintf("https://%s.tts.speech.microsoft.com/cognitiveservices/v1", r)
+    // 长文本按句子分段合成后拼接，原始 SSML 片段无法安全拆分
+    if !opts.RawSSML && CanConcatAudio(opts.OutputFormat) {
+        if chunks := SplitText(opts.Text, maxChunkChars); len(chunks) > 1 {
+            return synthesizeChunks(ctx, opts, chunks)
+        }
+    }
+
+    return SynthesizeSsmlStream(ctx, ssml, opts.OutputFormat)
+}
+
+// prepareSpeech 填充默认值、校验参数并生成 SSML
+func prepareSpeech(ctx context.Context, opts SpeechOptions) (SpeechOptions, string, error) {
+    opts.applyDefaults()
+    if !IsSupportedOutputFormat(opts.OutputFormat) {
+        return opts, "", fmt.Errorf("%w: %s", ErrUnsupportedFormat, opts.OutputFormat)
+    }
+
+    // 在查询语音列表之前检查参数，不合法的输入不会产生任何上游请求
+    if err := validateSpeechOptions(opts); err != nil {
+        return opts, "", err
+    }
+    if err := ValidateVoiceCapabilities(ctx, opts); err != nil {
+        return opts, "", err
+    }
+    opts.locale, opts.multilingual = resolveVoiceLocale(opts.VoiceName)
+
+    ssml, err := BuildSsml(opts)
+    if err != nil {
+        return opts, "", err
+    }
+    log.Debugf("SSML: %s", ssml)
+    return opts, ssml, nil
+}
+
+// SynthesizeSsmlStream 将完整的 SSML 文档发送给语音合成服务，按 TTS_PROVIDERS 的顺序在提供方之间回退
+func SynthesizeSsmlStream(ctx context.Context, ssml, outputFormat string) (io.ReadCloser, error) {
+    return withFallback(ctx, "synthesize", func(p Provider) (io.ReadCloser, error) {
+        return p.SynthesizeSsml(ctx, ssml, outputFormat)
+    })
+}
+
+// synthesizeRESTStream 通过 REST 接口合成 SSML
+func synthesizeRESTStream(ctx context.Context, cred *speechCredentials, ssml, outputFormat string) (io.ReadCloser, error) {
+    u := speechURL(cred.Region, "/cognitiveservices/v1")
     headers := map[string]string{
-        "Authorization":            endpoint["t"].(string),
+        "Authorization":            cred.Authorization,
         "Content-Type":             "application/ssml+xml",
         "X-Microsoft-OutputFormat": outputFormat,
     }
 
-    ssml := GetSsml(text, voiceName, rate, pitch)
-
-    req, err := http.NewRequest("POST", u, bytes.NewBufferString(ssml))
+    req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewBufferString(ssml))
     if err != nil {
         return nil, err
     }
@@ -170,55 +308,24 @@ func GetVoice(text, voiceName, rate, pitch, outputFormat string) ([]byte, error)
         log.Error("failed to do request: ", err)
         return nil, err
     }
-    defer resp.Body.Close()
-
-    return io.ReadAll(resp.Body)
-}
+    if err := checkResponse(resp); err != nil {
+        return nil, err
+    }
 
-// GetSsml 生成 SSML 格式的文本
-func GetSsml(text, voiceName, rate, pitch string) string {
-    return fmt.Sprintf(`
-   <speak xmlns="http://www.w3.org/2001/10/synthesis" xmlns:mstts="http://www.w3.org/2001/mstts" version="1.0" xml:lang="zh-CN">
-     <voice name="%s">
-       <mstts:express-as style="general" styledegree="1.0" role="default">
-         <prosody rate="%s%%" pitch="%s%%" volume="50">%s</prosody>
-       </mstts:express-as>
-     </voice>
-   </speak>
- `, voiceName, rate, pitch, text)
+    return resp.Body, nil
 }
 
 // VoiceList 获取可用的语音列表
-func VoiceList() ([]interface{}, error) {
-    // 如果缓存中有值，直接返回缓存的结果
-    if voiceListCache != nil {
-        return voiceListCache, nil
-    }
-
-    var result []interface{}
-    var err error
-    retries := 3
-
-    for i := 0; i < retries; i++ {
-        result, err = fetchVoiceList()
-        if err == nil {
-            break
-        }
-        log.Warnf("Attempt %d failed to fetch voice list: %v", i+1, err)
-        time.Sleep(time.Second * time.Duration(i+1))
-    }
-
-    if err != nil {
-        return nil, fmt.Errorf("failed to fetch voice list after %d attempts: %v", retries, err)
-    }
-
-    // 将结果存储到缓存中
-    voiceListCache = result
+func VoiceList() ([]Voice, error) {
+    return VoiceListContext(context.Background())
+}
 
-    return result, nil
+// VoiceListContext 获取可用的语音列表，缓存过期时返回旧数据并在后台刷新
+func VoiceListContext(ctx context.Context) ([]Voice, error) {
+    return voiceCache.Get(ctx)
 }
 
-func fetchVoiceList() ([]interface{}, error) {
+func fetchVoiceList(ctx context.Context) ([]Voice, error) {
     headers := map[string]string{
         "User-Agent":     "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/107.0.0.0 Safari/537.36 Edg/107.0.1418.26",
         "X-Ms-Useragent": "SpeechStudio/2021.05.001",
@@ -227,7 +334,7 @@ func fetchVoiceList() ([]interface{}, error) {
         "Referer":        "https://azure.microsoft.com",
     }
 
-    req, err := http.NewRequest("GET", voicesListURL, nil)
+    req, err := http.NewRequestWithContext(ctx, "GET", GetUpstreamURLs().Voices, nil)
     if err != nil {
         return nil, err
     }
@@ -236,14 +343,22 @@ func fetchVoiceList() ([]interface{}, error) {
         req.Header.Set(k, v)
     }
 
+    return doVoiceListRequest(req)
+}
+
+// doVoiceListRequest 发送语音列表请求并解析结果
+func doVoiceListRequest(req *http.Request) ([]Voice, error) {
     resp, err := client.Do(req)
     if err != nil {
         log.Error("failed to do request: ", err)
         return nil, err
     }
+    if err := checkResponse(resp); err != nil {
+        return nil, err
+    }
     defer resp.Body.Close()
 
-    var result []interface{}
+    var result []Voice
     err = json.NewDecoder(resp.Body).Decode(&result)
     if err != nil {
         return nil, err
@@ -265,9 +380,10 @@ func ByteCountIEC(b int64) string {
     return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
 }
 
-// ValidateToken 验证提供的 token 是否正确
+// ValidateToken 验证提供的 token 是否为有效的 API key 或 SECRET_TOKEN
 func ValidateToken(token string) bool {
-    return token == os.Getenv("SECRET_TOKEN")
+    _, err := keyStore.Authenticate(token)
+    return err == nil
 }
 
 func GenerateRequestID() string {
@@ -0,0 +1,129 @@
+package utils
+
+import (
+    "strings"
+)
+
+// Voice 语音列表中的一项
+type Voice struct {
+    Name                string              `json:"Name"`
+    DisplayName         string              `json:"DisplayName"`
+    LocalName           string              `json:"LocalName"`
+    ShortName           string              `json:"ShortName"`
+    Gender              string              `json:"Gender"`
+    Locale              string              `json:"Locale"`
+    LocaleName          string              `json:"LocaleName"`
+    StyleList           []string            `json:"StyleList,omitempty"`
+    RolePlayList        []string            `json:"RolePlayList,omitempty"`
+    SecondaryLocaleList []string            `json:"SecondaryLocaleList,omitempty"`
+    SampleRateHertz     string              `json:"SampleRateHertz"`
+    VoiceType           string              `json:"VoiceType"`
+    Status              string              `json:"Status"`
+    WordsPerMinute      string              `json:"WordsPerMinute,omitempty"`
+    VoiceTag            map[string][]string `json:"VoiceTag,omitempty"`
+}
+
+// IsMultilingual 判断语音是否支持多种语言
+func (v Voice) IsMultilingual() bool {
+    return len(v.SecondaryLocaleList) > 0 || strings.Contains(v.ShortName, "Multilingual")
+}
+
+// SupportsStyle 判断语音是否支持指定的说话风格
+func (v Voice) SupportsStyle(style string) bool {
+    return containsFold(v.StyleList, style)
+}
+
+// SupportsRole 判断语音是否支持指定的角色
+func (v Voice) SupportsRole(role string) bool {
+    return containsFold(v.RolePlayList, role)
+}
+
+// VoiceFilter 语音列表的筛选条件，空字段表示不筛选
+type VoiceFilter struct {
+    // Locale 精确匹配区域，如 zh-CN
+    Locale string
+    // LocalePrefix 匹配区域前缀，如 zh 匹配 zh-CN、zh-TW
+    LocalePrefix string
+    // LocaleContains 区域包含该字符串即匹配，兼容旧的 l 参数
+    LocaleContains string
+    Gender         string
+    Style          string
+    Role           string
+    VoiceType      string
+    // Search 在名称、显示名称和区域名称中搜索
+    Search string
+}
+
+// Match 判断语音是否满足筛选条件，字符串比较均不区分大小写
+func (f VoiceFilter) Match(v Voice) bool {
+    if f.Locale != "" && !strings.EqualFold(v.Locale, f.Locale) {
+        return false
+    }
+    if f.LocalePrefix != "" {
+        prefix := strings.ToLower(f.LocalePrefix)
+        locale := strings.ToLower(v.Locale)
+        if locale != prefix && !strings.HasPrefix(locale, prefix+"-") {
+            return false
+        }
+    }
+    if f.LocaleContains != "" && !strings.Contains(strings.ToLower(v.Locale), strings.ToLower(f.LocaleContains)) {
+        return false
+    }
+    if f.Gender != "" && !strings.EqualFold(v.Gender, f.Gender) {
+        return false
+    }
+    if f.Style != "" && !v.SupportsStyle(f.Style) {
+        return false
+    }
+    if f.Role != "" && !v.SupportsRole(f.Role) {
+        return false
+    }
+    if f.VoiceType != "" && !strings.EqualFold(v.VoiceType, f.VoiceType) {
+        return false
+    }
+    if f.Search != "" {
+        search := strings.ToLower(f.Search)
+        fields := []string{v.ShortName, v.DisplayName, v.LocalName, v.LocaleName, v.Locale}
+        found := false
+        for _, field := range fields {
+            if strings.Contains(strings.ToLower(field), search) {
+                found = true
+                break
+            }
+        }
+        if !found {
+            return false
+        }
+    }
+    return true
+}
+
+// FilterVoices 返回满足筛选条件的语音
+func FilterVoices(voices []Voice, filter VoiceFilter) []Voice {
+    result := make([]Voice, 0, len(voices))
+    for _, voice := range voices {
+        if filter.Match(voice) {
+            result = append(result, voice)
+        }
+    }
+    return result
+}
+
+// FindVoice 按 ShortName 查找语音，不区分大小写
+func FindVoice(voices []Voice, shortName string) (Voice, bool) {
+    for _, voice := range voices {
+        if strings.EqualFold(voice.ShortName, shortName) {
+            return voice, true
+        }
+    }
+    return Voice{}, false
+}
+
+func containsFold(list []string, value string) bool {
+    for _, item := range list {
+        if strings.EqualFold(item, value) {
+            return true
+        }
+    }
+    return false
+}
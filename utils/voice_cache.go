@@ -0,0 +1,300 @@
+package utils
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sync"
+    "time"
+)
+
+// voiceRetryBackoff 获取失败后至少等待该时间再重试，期间直接返回上次的错误，
+// 每次获取本身已包含多次重试，避免上游故障时每个请求都等待一轮
+const voiceRetryBackoff = 30 * time.Second
+
+// 语音列表的来源
+const (
+    VoiceSourceUpstream = "upstream"
+    VoiceSourceDisk     = "disk"
+)
+
+// VoiceCacheState 用于诊断输出的语音列表缓存状态
+type VoiceCacheState struct {
+    Count      int       `json:"count"`
+    Source     string    `json:"source,omitempty"`
+    FetchedAt  time.Time `json:"fetched_at,omitempty"`
+    Age        int64     `json:"age"`
+    Stale      bool      `json:"stale"`
+    Refreshing bool      `json:"refreshing"`
+    LastError  string    `json:"last_error,omitempty"`
+}
+
+// voiceCacheFile 持久化到磁盘的语音列表
+type voiceCacheFile struct {
+    FetchedAt time.Time `json:"fetched_at"`
+    Voices    []Voice   `json:"voices"`
+}
+
+// VoiceCache 并发安全的语音列表缓存，过期后先返回旧数据并在后台刷新，
+// 最近一次成功获取的列表会写入磁盘，离线启动时也能提供语音列表
+type VoiceCache struct {
+    mu         sync.Mutex
+    voices     []Voice
+    fetchedAt  time.Time
+    source     string
+    ttl        time.Duration
+    path       string
+    diskLoaded bool
+    inflight   chan struct{}
+    lastErr    error
+    failedAt   time.Time
+    fetch      func(ctx context.Context) ([]Voice, error)
+}
+
+// voiceCache 在 Init 中按 CACHE_DURATION 和 VOICE_CACHE_FILE 重新创建
+var voiceCache = NewVoiceCache(fetchVoiceListWithRetry, cacheDuration, "data/voices.json")
+
+// voiceCacheFilePath 语音列表的持久化路径，VOICE_CACHE_FILE=off 时不持久化
+func voiceCacheFilePath() string {
+    path := os.Getenv("VOICE_CACHE_FILE")
+    switch path {
+    case "":
+        return "data/voices.json"
+    case "off":
+        return ""
+    default:
+        return path
+    }
+}
+
+// NewVoiceCache 创建语音列表缓存，path 为空时不持久化
+func NewVoiceCache(fetch func(ctx context.Context) ([]Voice, error), ttl time.Duration, path string) *VoiceCache {
+    return &VoiceCache{fetch: fetch, ttl: ttl, path: path}
+}
+
+// Get 返回语音列表，没有任何数据时等待首次获取完成
+func (c *VoiceCache) Get(ctx context.Context) ([]Voice, error) {
+    c.mu.Lock()
+    c.loadFromDiskLocked()
+    now := time.Now()
+
+    if c.voices != nil {
+        if now.Sub(c.fetchedAt) > c.ttl && c.canRetryLocked(now) {
+            c.startRefreshLocked()
+        }
+        voices := c.voices
+        c.mu.Unlock()
+        return voices, nil
+    }
+
+    // 刚刚获取失败时直接返回上次的错误
+    if c.inflight == nil && c.lastErr != nil && !c.canRetryLocked(now) {
+        err := c.lastErr
+        c.mu.Unlock()
+        return nil, err
+    }
+
+    done := c.startRefreshLocked()
+    c.mu.Unlock()
+
+    select {
+    case <-done:
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    }
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if c.voices != nil {
+        return c.voices, nil
+    }
+    if c.lastErr != nil {
+        return nil, c.lastErr
+    }
+    return nil, errors.New("voice list unavailable")
+}
+
+// Cached 返回内存或磁盘中已有的语音列表，没有时返回 nil 而不等待获取；
+// 没有数据或已过期时在后台获取，供之后的请求使用
+func (c *VoiceCache) Cached() []Voice {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.loadFromDiskLocked()
+
+    now := time.Now()
+    if (c.voices == nil || now.Sub(c.fetchedAt) > c.ttl) && c.canRetryLocked(now) {
+        c.startRefreshLocked()
+    }
+    return c.voices
+}
+
+// Reset 丢弃内存中的语音列表、进行中的获取和上次获取失败的记录，下次调用立即重新获取；磁盘上的列表只在启动时加载一次
+func (c *VoiceCache) Reset() {
+    c.mu.Lock()
+    c.voices = nil
+    c.fetchedAt = time.Time{}
+    c.source = ""
+    c.lastErr = nil
+    c.failedAt = time.Time{}
+    c.inflight = nil
+    c.mu.Unlock()
+}
+
+// canRetryLocked 判断距离上次获取失败是否已超过退避时间，调用方需持有锁
+func (c *VoiceCache) canRetryLocked(now time.Time) bool {
+    return c.failedAt.IsZero() || now.Sub(c.failedAt) >= voiceRetryBackoff
+}
+
+// State 返回缓存的状态
+func (c *VoiceCache) State() VoiceCacheState {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    state := VoiceCacheState{
+        Count:      len(c.voices),
+        Source:     c.source,
+        Refreshing: c.inflight != nil,
+    }
+    if !c.fetchedAt.IsZero() {
+        age := time.Since(c.fetchedAt)
+        state.FetchedAt = c.fetchedAt
+        state.Age = int64(age.Seconds())
+        state.Stale = age > c.ttl
+    }
+    if c.lastErr != nil {
+        state.LastError = c.lastErr.Error()
+    }
+    return state
+}
+
+// startRefreshLocked 启动一次后台刷新，已有刷新在进行时复用它，调用方需持有锁
+func (c *VoiceCache) startRefreshLocked() chan struct{} {
+    if c.inflight != nil {
+        return c.inflight
+    }
+    done := make(chan struct{})
+    c.inflight = done
+
+    go func() {
+        // 刷新由所有等待者共享，不绑定单个请求的 ctx
+        ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+        voices, err := c.fetch(ctx)
+        cancel()
+
+        c.mu.Lock()
+        // Reset 之后完成的获取属于旧地址，结果直接丢弃
+        current := c.inflight == done
+        switch {
+        case !current:
+        case err != nil:
+            log.Errorf("failed to refresh voice list: %v", err)
+            c.lastErr = err
+            c.failedAt = time.Now()
+        default:
+            c.voices = voices
+            c.fetchedAt = time.Now()
+            c.source = VoiceSourceUpstream
+            c.lastErr = nil
+            c.failedAt = time.Time{}
+        }
+        if current {
+            c.inflight = nil
+        }
+        fetchedAt := c.fetchedAt
+        c.mu.Unlock()
+
+        if current && err == nil {
+            log.Infof("voice list refreshed, %d voices", len(voices))
+            c.saveToDisk(voices, fetchedAt)
+        }
+        close(done)
+    }()
+
+    return done
+}
+
+// loadFromDiskLocked 首次访问时从磁盘加载上次保存的语音列表，调用方需持有锁
+func (c *VoiceCache) loadFromDiskLocked() {
+    if c.diskLoaded || c.path == "" {
+        return
+    }
+    c.diskLoaded = true
+
+    data, err := os.ReadFile(c.path)
+    if err != nil {
+        if !errors.Is(err, os.ErrNotExist) {
+            log.Warnf("failed to read voice cache file: %v", err)
+        }
+        return
+    }
+
+    var file voiceCacheFile
+    if err := json.Unmarshal(data, &file); err != nil || len(file.Voices) == 0 {
+        log.Warnf("ignoring invalid voice cache file %s", c.path)
+        return
+    }
+
+    c.voices = file.Voices
+    c.fetchedAt = file.FetchedAt
+    c.source = VoiceSourceDisk
+    log.Infof("loaded %d voices from %s, fetched at %s", len(file.Voices), c.path, file.FetchedAt.Format(time.RFC3339))
+}
+
+// saveToDisk 先写临时文件再重命名，避免写到一半的文件被读取
+func (c *VoiceCache) saveToDisk(voices []Voice, fetchedAt time.Time) {
+    if c.path == "" {
+        return
+    }
+
+    data, err := json.Marshal(voiceCacheFile{FetchedAt: fetchedAt, Voices: voices})
+    if err != nil {
+        log.Warnf("failed to encode voice cache: %v", err)
+        return
+    }
+    if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+        log.Warnf("failed to create voice cache directory: %v", err)
+        return
+    }
+
+    tmp := c.path + ".tmp"
+    if err := os.WriteFile(tmp, data, 0o644); err != nil {
+        log.Warnf("failed to write voice cache file: %v", err)
+        return
+    }
+    if err := os.Rename(tmp, c.path); err != nil {
+        log.Warnf("failed to replace voice cache file: %v", err)
+    }
+}
+
+// fetchVoiceListWithRetry 获取语音列表，失败时最多重试 3 次
+func fetchVoiceListWithRetry(ctx context.Context) ([]Voice, error) {
+    var result []Voice
+    var err error
+    retries := 3
+
+    for i := 0; i < retries; i++ {
+        result, err = fetchProviderVoices(ctx)
+        if err == nil {
+            return result, nil
+        }
+        log.Warnf("Attempt %d failed to fetch voice list: %v", i+1, err)
+        if ctx.Err() != nil {
+            return nil, err
+        }
+        if i < retries-1 {
+            if sleepErr := sleepContext(ctx, time.Second*time.Duration(i+1)); sleepErr != nil {
+                return nil, sleepErr
+            }
+        }
+    }
+
+    return nil, fmt.Errorf("failed to fetch voice list after %d attempts: %w", retries, err)
+}
+
+// GetVoiceCacheState 返回语音列表缓存的诊断信息
+func GetVoiceCacheState() VoiceCacheState {
+    return voiceCache.State()
+}
@@ -0,0 +1,395 @@
+package utils
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "crypto/tls"
+    "encoding/binary"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+
+    "github.com/google/uuid"
+    "golang.org/x/net/websocket"
+)
+
+// synthesisBackend 合成方式，rest 或 websocket，在 Init 中读取 SYNTHESIS_BACKEND
+var synthesisBackend string
+
+// 合成过程中的元数据事件类型
+const (
+    EventWordBoundary     = "WordBoundary"
+    EventSentenceBoundary = "SentenceBoundary"
+    EventBookmark         = "Bookmark"
+    EventViseme           = "Viseme"
+)
+
+// SynthesisEvent 合成过程中上游返回的带时间的元数据
+type SynthesisEvent struct {
+    Type string `json:"type"`
+    // Offset 事件在音频中的位置，Duration 为单词或句子的时长
+    Offset   time.Duration `json:"offset"`
+    Duration time.Duration `json:"duration,omitempty"`
+    // Text 单词或句子的文本，TextOffset 为其在 SSML 中的位置
+    Text       string `json:"text,omitempty"`
+    TextOffset int    `json:"text_offset,omitempty"`
+    Length     int    `json:"length,omitempty"`
+    // BoundaryType 单词边界的细分类型，如 WordBoundary、PunctuationBoundary
+    BoundaryType string `json:"boundary_type,omitempty"`
+    VisemeID     int    `json:"viseme_id,omitempty"`
+    Bookmark     string `json:"bookmark,omitempty"`
+}
+
+// websocketMessage 上游发来的一条消息
+type websocketMessage struct {
+    headers map[string]string
+    body    []byte
+    binary  bool
+}
+
+// websocketCodec 在读取时保留帧类型，文本帧为控制消息，二进制帧为音频
+var websocketCodec = websocket.Codec{
+    Marshal: func(v interface{}) ([]byte, byte, error) {
+        switch data := v.(type) {
+        case string:
+            return []byte(data), websocket.TextFrame, nil
+        case []byte:
+            return data, websocket.BinaryFrame, nil
+        default:
+            return nil, 0, errors.New("unsupported websocket message")
+        }
+    },
+    Unmarshal: func(data []byte, payloadType byte, v interface{}) error {
+        msg, ok := v.(*websocketMessage)
+        if !ok {
+            return errors.New("unsupported websocket message")
+        }
+        return parseWebsocketMessage(data, payloadType == websocket.BinaryFrame, msg)
+    },
+}
+
+func parseWebsocketMessage(data []byte, isBinary bool, msg *websocketMessage) error {
+    msg.binary = isBinary
+    var head []byte
+    if isBinary {
+        // 二进制帧：2 字节大端头部长度 + 头部 + 音频
+        if len(data) < 2 {
+            return errors.New("short binary websocket message")
+        }
+        size := int(binary.BigEndian.Uint16(data[:2]))
+        if 2+size > len(data) {
+            return errors.New("invalid binary websocket message header")
+        }
+        head = data[2 : 2+size]
+        msg.body = data[2+size:]
+    } else {
+        parts := bytes.SplitN(data, []byte("\r\n\r\n"), 2)
+        head = parts[0]
+        msg.body = nil
+        if len(parts) == 2 {
+            msg.body = parts[1]
+        }
+    }
+
+    msg.headers = make(map[string]string)
+    for _, line := range strings.Split(string(head), "\r\n") {
+        if i := strings.Index(line, ":"); i > 0 {
+            msg.headers[strings.ToLower(strings.TrimSpace(line[:i]))] = strings.TrimSpace(line[i+1:])
+        }
+    }
+    return nil
+}
+
+// websocketFrame 组装发送给上游的文本消息
+func websocketFrame(path, contentType, requestID, body string) string {
+    return fmt.Sprintf("X-Timestamp:%s\r\nX-RequestId:%s\r\nContent-Type:%s\r\nPath:%s\r\n\r\n%s",
+        time.Now().UTC().Format("2006-01-02T15:04:05.000Z"), requestID, contentType, path, body)
+}
+
+// speechConfig 开启单词、句子边界、书签和口型元数据
+func speechConfig(outputFormat string) string {
+    config := map[string]interface{}{
+        "context": map[string]interface{}{
+            "synthesis": map[string]interface{}{
+                "audio": map[string]interface{}{
+                    "metadataoptions": map[string]interface{}{
+                        "bookmarkEnabled":            true,
+                        "punctuationBoundaryEnabled": true,
+                        "sentenceBoundaryEnabled":    true,
+                        "wordBoundaryEnabled":        true,
+                        "visemeEnabled":              true,
+                    },
+                    "outputFormat": outputFormat,
+                },
+                "language": map[string]interface{}{
+                    "autoDetection": false,
+                },
+            },
+        },
+    }
+    data, _ := json.Marshal(config)
+    return string(data)
+}
+
+// audioMetadata audio.metadata 消息的内容，时间单位为 100 纳秒
+type audioMetadata struct {
+    Metadata []struct {
+        Type string `json:"Type"`
+        Data struct {
+            Offset   int64 `json:"Offset"`
+            Duration int64 `json:"Duration"`
+            Text     struct {
+                Text         string `json:"Text"`
+                Length       int    `json:"Length"`
+                BoundaryType string `json:"BoundaryType"`
+            } `json:"text"`
+            VisemeID int    `json:"VisemeId"`
+            Bookmark string `json:"Bookmark"`
+        } `json:"Data"`
+    } `json:"Metadata"`
+}
+
+func parseMetadata(body []byte) ([]SynthesisEvent, error) {
+    var metadata audioMetadata
+    if err := json.Unmarshal(body, &metadata); err != nil {
+        return nil, err
+    }
+    events := make([]SynthesisEvent, 0, len(metadata.Metadata))
+    for _, item := range metadata.Metadata {
+        eventType := item.Type
+        // 标点边界归入单词边界，通过 BoundaryType 区分
+        if eventType == "PunctuationBoundary" {
+            eventType = EventWordBoundary
+        }
+        events = append(events, SynthesisEvent{
+            Type:         eventType,
+            Offset:       time.Duration(item.Data.Offset) * 100,
+            Duration:     time.Duration(item.Data.Duration) * 100,
+            Text:         item.Data.Text.Text,
+            Length:       item.Data.Text.Length,
+            BoundaryType: item.Data.Text.BoundaryType,
+            VisemeID:     item.Data.VisemeID,
+            Bookmark:     item.Data.Bookmark,
+        })
+    }
+    return events, nil
+}
+
+// websocketStream WebSocket 合成的音频流，关闭时断开连接
+type websocketStream struct {
+    *io.PipeReader
+    conn *websocket.Conn
+}
+
+func (s *websocketStream) Close() error {
+    s.conn.Close()
+    return s.PipeReader.Close()
+}
+
+// SynthesizeWebSocketStream 通过 WebSocket 协议合成 SSML，音频以流的形式返回，
+// 单词边界、句子边界、书签和口型事件通过 onEvent 回调，onEvent 可以为 nil
+func SynthesizeWebSocketStream(ctx context.Context, ssml, outputFormat string, onEvent func(SynthesisEvent)) (io.ReadCloser, error) {
+    return withFallback(ctx, "synthesize", func(p Provider) (io.ReadCloser, error) {
+        return p.SynthesizeSsmlWithEvents(ctx, ssml, outputFormat, onEvent)
+    })
+}
+
+// synthesizeWebSocketStream 使用给定的授权信息建立 WebSocket 连接并合成
+func synthesizeWebSocketStream(ctx context.Context, cred *speechCredentials, ssml, outputFormat string, onEvent func(SynthesisEvent)) (io.ReadCloser, error) {
+    connectionID := strings.ReplaceAll(uuid.New().String(), "-", "")
+    location, err := url.Parse(speechWebsocketURL(cred.Region, "/cognitiveservices/websocket/v1") + "?X-ConnectionId=" + connectionID)
+    if err != nil {
+        return nil, err
+    }
+    config, err := websocket.NewConfig(location.String(), "https://"+location.Host)
+    if err != nil {
+        return nil, err
+    }
+    config.Header = http.Header{}
+    config.Header.Set("Authorization", cred.Authorization)
+    config.Header.Set("User-Agent", userAgent)
+
+    dialCtx, cancel := context.WithTimeout(ctx, connectTimeout)
+    conn, err := dialWebsocket(dialCtx, config)
+    cancel()
+    if err != nil {
+        log.Error("failed to dial websocket: ", err)
+        return nil, err
+    }
+
+    requestID := strings.ReplaceAll(uuid.New().String(), "-", "")
+    if err := websocketCodec.Send(conn, websocketFrame("speech.config", "application/json; charset=utf-8", requestID, speechConfig(outputFormat))); err != nil {
+        conn.Close()
+        return nil, err
+    }
+    if err := websocketCodec.Send(conn, websocketFrame("ssml", "application/ssml+xml", requestID, ssml)); err != nil {
+        conn.Close()
+        return nil, err
+    }
+
+    // ctx 结束时断开连接，使阻塞中的读取立即返回
+    stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+    pr, pw := io.Pipe()
+    go func() {
+        defer stop()
+        defer conn.Close()
+        pw.CloseWithError(readWebsocketTurn(ctx, conn, pw, onEvent))
+    }()
+
+    return &websocketStream{PipeReader: pr, conn: conn}, nil
+}
+
+// handshakeRecorder 记录握手阶段读到的数据，握手失败时用于解析上游的响应
+type handshakeRecorder struct {
+    net.Conn
+    buf  bytes.Buffer
+    done bool
+}
+
+func (r *handshakeRecorder) Read(p []byte) (int, error) {
+    n, err := r.Conn.Read(p)
+    if remaining := 8192 - r.buf.Len(); !r.done && remaining > 0 {
+        r.buf.Write(p[:min(n, remaining)])
+    }
+    return n, err
+}
+
+// dialWebsocket 建立 WebSocket 连接，握手被拒绝时与 REST 接口一样按上游返回的状态码分类错误，
+// 例如 429 保留 Retry-After，503 不会被当作授权失败
+func dialWebsocket(ctx context.Context, config *websocket.Config) (*websocket.Conn, error) {
+    location := config.Location
+    addr := location.Host
+    if location.Port() == "" {
+        if location.Scheme == "wss" {
+            addr = net.JoinHostPort(location.Hostname(), "443")
+        } else {
+            addr = net.JoinHostPort(location.Hostname(), "80")
+        }
+    }
+
+    dialer := &net.Dialer{}
+    var conn net.Conn
+    var err error
+    switch location.Scheme {
+    case "ws":
+        conn, err = dialer.DialContext(ctx, "tcp", addr)
+    case "wss":
+        conn, err = (&tls.Dialer{NetDialer: dialer, Config: config.TlsConfig}).DialContext(ctx, "tcp", addr)
+    default:
+        err = websocket.ErrBadScheme
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    // 握手本身不支持 ctx，超时或取消时通过截止时间中断
+    stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+    recorder := &handshakeRecorder{Conn: conn}
+    ws, err := websocket.NewClient(config, recorder)
+    recorder.done = true
+    if !stop() {
+        conn.Close()
+        return nil, ctx.Err()
+    }
+    if err == nil {
+        return ws, nil
+    }
+    conn.Close()
+
+    if errors.Is(err, websocket.ErrBadStatus) {
+        resp, parseErr := http.ReadResponse(bufio.NewReader(bytes.NewReader(recorder.buf.Bytes())), nil)
+        if parseErr == nil {
+            if err := checkResponse(resp); err != nil {
+                return nil, err
+            }
+        }
+        return nil, fmt.Errorf("%w: websocket handshake failed: %v", ErrUpstreamUnavailable, err)
+    }
+    return nil, err
+}
+
+// readWebsocketTurn 读取一次合成的全部消息，直到 turn.end
+func readWebsocketTurn(ctx context.Context, conn *websocket.Conn, audio io.Writer, onEvent func(SynthesisEvent)) error {
+    for {
+        conn.SetReadDeadline(time.Now().Add(readTimeout))
+
+        var msg websocketMessage
+        if err := websocketCodec.Receive(conn, &msg); err != nil {
+            if ctx.Err() != nil {
+                return ctx.Err()
+            }
+            if err == io.EOF {
+                return fmt.Errorf("%w: websocket closed before turn.end", ErrUpstreamUnavailable)
+            }
+            return err
+        }
+
+        switch path := msg.headers["path"]; {
+        case msg.binary && path == "audio":
+            if len(msg.body) == 0 {
+                continue
+            }
+            if _, err := audio.Write(msg.body); err != nil {
+                return err
+            }
+        case path == "audio.metadata":
+            if onEvent == nil {
+                continue
+            }
+            events, err := parseMetadata(msg.body)
+            if err != nil {
+                log.Warnf("failed to parse audio metadata: %v", err)
+                continue
+            }
+            for _, event := range events {
+                onEvent(event)
+            }
+        case path == "turn.end":
+            return nil
+        case path == "turn.start", path == "response":
+        default:
+            log.Debugf("ignoring websocket message with path %q", path)
+        }
+    }
+}
+
+// SynthesizeWithMetadata 合成语音并返回全部音频和元数据事件，长文本与 SynthesizeStream 一样分段合成
+func SynthesizeWithMetadata(ctx context.Context, opts SpeechOptions) ([]byte, []SynthesisEvent, error) {
+    opts, ssml, err := prepareSpeech(ctx, opts)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    if !opts.RawSSML && CanConcatAudio(opts.OutputFormat) {
+        if chunks := SplitText(opts.Text, maxChunkChars); len(chunks) > 1 {
+            return synthesizeChunksWithMetadata(ctx, opts, chunks)
+        }
+    }
+    return synthesizeWithEvents(ctx, ssml, opts.OutputFormat)
+}
+
+// synthesizeWithEvents 合成一个 SSML 文档并收集全部元数据事件
+func synthesizeWithEvents(ctx context.Context, ssml, outputFormat string) ([]byte, []SynthesisEvent, error) {
+    var events []SynthesisEvent
+    body, err := SynthesizeWebSocketStream(ctx, ssml, outputFormat, func(event SynthesisEvent) {
+        events = append(events, event)
+    })
+    if err != nil {
+        return nil, nil, err
+    }
+    defer body.Close()
+
+    audio, err := io.ReadAll(body)
+    if err != nil {
+        return nil, nil, err
+    }
+    return audio, events, nil
+}